@@ -0,0 +1,280 @@
+// 公众号的关键词自动回复和固定回复的文案，从规则文件中加载，修改后不需要重启服务
+package autoreply
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// 匹配方式
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchRegex  = "regex"
+)
+
+// 活动时间窗口的时间格式，使用服务器本地时区
+const TimeLayout = "2006-01-02 15:04"
+
+// 没有配置规则文件时使用的默认规则，规则文件中缺少的固定回复也从这里取
+//
+//go:embed default.json
+var defaultData []byte
+
+var ErrNoRule = errors.New("no matched rule")
+
+// Vars 回复模板中可以使用的变量，例如 {{.Address}}、{{.Wait}}、{{.TxHash}}
+type Vars map[string]interface{}
+
+// Rule 一条关键词回复规则
+type Rule struct {
+	Name     string   `json:"name"`
+	Match    string   `json:"match"`    // 匹配方式: exact、prefix、regex
+	Keywords []string `json:"keywords"` // 关键词，regex方式下为正则表达式
+	Start    string   `json:"start"`    // 活动开始时间，为空表示不限制
+	End      string   `json:"end"`      // 活动结束时间，为空表示不限制
+	Reply    *Reply   `json:"reply"`    // 回复，文本模板中可以使用 {{.Content}} 和正则的分组 {{index .Args 1}}
+
+	patterns []*regexp.Regexp
+	start    time.Time
+	end      time.Time
+}
+
+// File 规则文件的内容
+type File struct {
+	Rules    []*Rule           `json:"rules"`
+	Messages map[string]*Reply `json:"messages"` // 固定回复，例如 welcome、claimAccepted、payoutConfirmed
+}
+
+// ruleSet 解析好的规则，重新加载时整体替换
+type ruleSet struct {
+	rules    []*Rule
+	messages map[string]*Reply
+}
+
+// Replies 当前生效的回复规则
+type Replies struct {
+	path    string
+	lock    sync.RWMutex
+	set     *ruleSet
+	modTime time.Time
+
+	watchLock sync.Mutex    // 保护quit
+	quit      chan struct{} // 正在监听规则文件时不为nil
+}
+
+// Load 加载规则文件，path为空时只使用默认规则
+func Load(path string) (*Replies, error) {
+	r := &Replies{path: path}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 重新读取规则文件，解析失败时保留原来的规则
+func (r *Replies) Reload() error {
+	data := defaultData
+	var modTime time.Time
+	if r.path != "" {
+		var err error
+		if modTime, err = fileModTime(r.path); err != nil {
+			return err
+		}
+		if data, err = ioutil.ReadFile(r.path); err != nil {
+			return err
+		}
+	}
+	set, err := parse(data)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// 解析失败时也记录修改时间，避免每次检查都重新加载同一个错误的文件
+	r.modTime = modTime
+	if err != nil {
+		return fmt.Errorf("parse replies file %s error: %v", r.path, err)
+	}
+	r.set = set
+	log.Printf("load %d auto reply rules from %q\n", len(set.rules), r.path)
+	return nil
+}
+
+// parse 解析并校验规则，固定回复缺少的部分使用默认文案
+func parse(data []byte) (*ruleSet, error) {
+	file := &File{}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, err
+	}
+	defaults := &File{}
+	if err := json.Unmarshal(defaultData, defaults); err != nil {
+		return nil, err
+	}
+	set := &ruleSet{messages: make(map[string]*Reply)}
+	for name, reply := range defaults.Messages {
+		if _, ok := file.Messages[name]; !ok {
+			set.messages[name] = reply
+		}
+	}
+	for name, reply := range file.Messages {
+		set.messages[name] = reply
+	}
+	for name, reply := range set.messages {
+		if reply == nil {
+			return nil, fmt.Errorf("message %s is empty", name)
+		}
+		if err := reply.compile(name); err != nil {
+			return nil, fmt.Errorf("message %s: %v", name, err)
+		}
+	}
+	for i, rule := range file.Rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("rule %d(%s): %v", i, rule.Name, err)
+		}
+		set.rules = append(set.rules, rule)
+	}
+	return set, nil
+}
+
+// compile 解析规则的时间窗口、正则和回复模板
+func (rule *Rule) compile() error {
+	if len(rule.Keywords) == 0 {
+		return errors.New("no keywords")
+	}
+	if rule.Reply == nil {
+		return errors.New("no reply")
+	}
+	switch rule.Match {
+	case MatchExact, MatchPrefix:
+	case MatchRegex:
+		for _, expr := range rule.Keywords {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return err
+			}
+			rule.patterns = append(rule.patterns, re)
+		}
+	default:
+		return fmt.Errorf("invalid match %q", rule.Match)
+	}
+	var err error
+	if rule.Start != "" {
+		if rule.start, err = time.ParseInLocation(TimeLayout, rule.Start, time.Local); err != nil {
+			return err
+		}
+	}
+	if rule.End != "" {
+		if rule.end, err = time.ParseInLocation(TimeLayout, rule.End, time.Local); err != nil {
+			return err
+		}
+	}
+	return rule.Reply.compile(rule.Name)
+}
+
+// Active 规则在now时是否在活动时间内
+func (rule *Rule) Active(now time.Time) bool {
+	if !rule.start.IsZero() && now.Before(rule.start) {
+		return false
+	}
+	return rule.end.IsZero() || now.Before(rule.end)
+}
+
+// match 匹配成功时返回参数，第一个参数为用户发送的内容，正则方式下后面为匹配到的分组
+func (rule *Rule) match(content string) ([]string, bool) {
+	switch rule.Match {
+	case MatchExact:
+		for _, keyword := range rule.Keywords {
+			if content == keyword {
+				return []string{content}, true
+			}
+		}
+	case MatchPrefix:
+		for _, keyword := range rule.Keywords {
+			if strings.HasPrefix(content, keyword) {
+				return []string{content, strings.TrimSpace(strings.TrimPrefix(content, keyword))}, true
+			}
+		}
+	case MatchRegex:
+		for _, re := range rule.patterns {
+			if args := re.FindStringSubmatch(content); args != nil {
+				args[0] = content
+				return args, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Match 按文件中的顺序查找第一条在活动时间内且匹配content的规则
+func (r *Replies) Match(content string, now time.Time) (*Rule, []string) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, rule := range r.set.rules {
+		if !rule.Active(now) {
+			continue
+		}
+		if args, ok := rule.match(content); ok {
+			return rule, args
+		}
+	}
+	return nil, nil
+}
+
+// Reply 匹配content并生成回复，模板中可以使用vars以及 Content、Args 变量
+func (r *Replies) Reply(content string, now time.Time, vars Vars) (*Reply, error) {
+	rule, args := r.Match(content, now)
+	if rule == nil {
+		return nil, ErrNoRule
+	}
+	if vars == nil {
+		vars = make(Vars)
+	}
+	vars["Content"] = content
+	vars["Args"] = args
+	return rule.Reply.render(vars)
+}
+
+// Message 生成名为name的固定回复，不存在或者生成失败时返回nil
+func (r *Replies) Message(name string, vars Vars) *Reply {
+	r.lock.RLock()
+	message, ok := r.set.messages[name]
+	r.lock.RUnlock()
+	if !ok {
+		log.Println("auto reply message not found:", name)
+		return nil
+	}
+	reply, err := message.render(vars)
+	if err != nil {
+		log.Printf("render auto reply message %s error: %v\n", name, err)
+		return nil
+	}
+	return reply
+}
+
+// Text 生成名为name的固定回复的文本，用于只能发送文本的场景，例如客服消息
+func (r *Replies) Text(name string, vars Vars) string {
+	reply := r.Message(name, vars)
+	if reply == nil {
+		return ""
+	}
+	if reply.Type != TypeText {
+		log.Printf("auto reply message %s is %s, only the content is used\n", name, reply.Type)
+	}
+	return reply.Content
+}
+
+func render(tmpl *template.Template, vars Vars) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
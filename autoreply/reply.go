@@ -0,0 +1,98 @@
+package autoreply
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/template"
+)
+
+// 回复的消息类型
+const (
+	TypeText  = "text"
+	TypeNews  = "news"
+	TypeImage = "image"
+	TypeVoice = "voice"
+	TypeMusic = "music"
+)
+
+// 一条图文回复最多包含的文章数，微信的限制
+const maxArticles = 8
+
+// Article 图文回复中的一篇文章
+type Article struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	PicUrl      string `json:"picUrl"` // 图片链接，大图360*200，小图200*200
+	Url         string `json:"url"`    // 点击图文跳转的链接
+}
+
+// Music 音乐回复
+type Music struct {
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	MusicUrl     string `json:"musicUrl"`
+	HQMusicUrl   string `json:"hqMusicUrl"` // 高质量音乐链接，wifi环境优先使用
+	ThumbMediaId string `json:"thumbMediaId"`
+}
+
+// Reply 一条回复，可以是文本、图文、图片、语音或音乐。
+// 在规则文件中可以直接写一个字符串，表示文本回复
+type Reply struct {
+	Type     string     `json:"type"`     // text(默认)、news、image、voice、music
+	Content  string     `json:"content"`  // 文本回复的模板
+	Articles []*Article `json:"articles"` // 图文回复的文章，最多8篇
+	MediaId  string     `json:"mediaId"`  // 图片、语音回复的素材media_id
+	Music    *Music     `json:"music"`
+
+	tmpl *template.Template
+}
+
+// UnmarshalJSON 支持字符串形式的文本回复
+func (reply *Reply) UnmarshalJSON(data []byte) error {
+	var content string
+	if err := json.Unmarshal(data, &content); err == nil {
+		*reply = Reply{Type: TypeText, Content: content}
+		return nil
+	}
+	type plain Reply
+	return json.Unmarshal(data, (*plain)(reply))
+}
+
+// compile 校验回复的内容并解析文本模板
+func (reply *Reply) compile(name string) error {
+	if reply.Type == "" {
+		reply.Type = TypeText
+	}
+	switch reply.Type {
+	case TypeText:
+	case TypeNews:
+		if len(reply.Articles) == 0 || len(reply.Articles) > maxArticles {
+			return fmt.Errorf("news reply must have 1 to %d articles", maxArticles)
+		}
+	case TypeImage, TypeVoice:
+		if reply.MediaId == "" {
+			return fmt.Errorf("%s reply needs mediaId", reply.Type)
+		}
+	case TypeMusic:
+		if reply.Music == nil {
+			return errors.New("music reply needs music")
+		}
+	default:
+		return fmt.Errorf("invalid reply type %q", reply.Type)
+	}
+	var err error
+	reply.tmpl, err = template.New(name).Parse(reply.Content)
+	return err
+}
+
+// render 用vars生成文本内容，返回一份新的回复
+func (reply *Reply) render(vars Vars) (*Reply, error) {
+	rendered := *reply
+	content, err := render(reply.tmpl, vars)
+	if err != nil {
+		return nil, err
+	}
+	rendered.Content = content
+	return &rendered, nil
+}
@@ -0,0 +1,83 @@
+package autoreply
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// 检查规则文件是否修改的间隔
+const watchInterval = 5 * time.Second
+
+// Watch 规则文件修改或者收到SIGHUP信号时重新加载规则
+func (r *Replies) Watch() {
+	r.watchLock.Lock()
+	defer r.watchLock.Unlock()
+	if r.quit != nil {
+		return
+	}
+	// goroutine中使用局部变量，Stop把r.quit置为nil之后仍能收到关闭
+	quit := make(chan struct{})
+	r.quit = quit
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-hup:
+				log.Println("receive SIGHUP, reload auto reply rules")
+				r.reload()
+			case <-ticker.C:
+				if r.changed() {
+					log.Println("auto reply rules file changed, reload")
+					r.reload()
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止监听规则文件
+func (r *Replies) Stop() {
+	r.watchLock.Lock()
+	defer r.watchLock.Unlock()
+	if r.quit != nil {
+		close(r.quit)
+		r.quit = nil
+	}
+}
+
+func (r *Replies) reload() {
+	if err := r.Reload(); err != nil {
+		log.Println("reload auto reply rules error, keep the old rules:", err)
+	}
+}
+
+// changed 规则文件的修改时间和上次加载时不同
+func (r *Replies) changed() bool {
+	if r.path == "" {
+		return false
+	}
+	modTime, err := fileModTime(r.path)
+	if err != nil {
+		return false
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return !modTime.Equal(r.modTime)
+}
+
+func fileModTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,141 @@
+// claim 通过水龙头的http接口申请测试币，给CI脚本等没有微信的场景使用
+//
+//	claim [-url http://127.0.0.1:8088] [-wait 5m] <Lemo地址>
+//
+// 水龙头开启了 api.requirePoW 时自动获取题目并完成工作量证明。
+// -wait 大于0时等待交易上链，超时或者发放失败时退出码为1
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lemoTestCoin/pow"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// 查询申请状态的间隔
+const pollInterval = 3 * time.Second
+
+// 接口返回的错误
+type apiError struct {
+	Code       string `json:"error"`
+	Message    string `json:"message"`
+	RetryAfter int64  `json:"retryAfter"`
+}
+
+func (e *apiError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s: %s (retry after %ds)", e.Code, e.Message, e.RetryAfter)
+	}
+	return e.Code + ": " + e.Message
+}
+
+// 申请记录
+type claim struct {
+	ID      uint64 `json:"id"`
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+	Status  string `json:"status"`
+	TxHash  string `json:"txHash"`
+	Error   string `json:"error"`
+}
+
+var (
+	baseUrl    string
+	httpClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.StringVar(&baseUrl, "url", "http://127.0.0.1:8088", "水龙头的地址")
+	wait := flag.Duration("wait", 0, "等待交易上链的最长时间，0表示不等待")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: claim [-url http://127.0.0.1:8088] [-wait 5m] <address>")
+		os.Exit(2)
+	}
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+
+	req := map[string]string{"address": flag.Arg(0)}
+	challenge := &pow.Challenge{}
+	err := call(http.MethodGet, "/api/v1/challenge", nil, challenge)
+	if e, ok := err.(*apiError); ok && e.Code == "not_found" {
+		// 水龙头没有开启工作量证明
+	} else if err != nil {
+		log.Fatal("get challenge error: ", err)
+	} else {
+		start := time.Now()
+		req["nonce"] = challenge.Nonce
+		req["solution"] = pow.Solve(challenge.Nonce, challenge.Difficulty)
+		fmt.Printf("solved challenge (difficulty %d) in %s\n", challenge.Difficulty, time.Since(start).Round(time.Millisecond))
+	}
+
+	result := &claim{}
+	if err = call(http.MethodPost, "/api/v1/claim", req, result); err != nil {
+		log.Fatal("claim error: ", err)
+	}
+	fmt.Printf("claim %d accepted, %s mo to %s\n", result.ID, result.Amount, result.Address)
+	if *wait <= 0 {
+		return
+	}
+
+	deadline := time.Now().Add(*wait)
+	for {
+		if err = call(http.MethodGet, fmt.Sprintf("/api/v1/claim/%d", result.ID), nil, result); err != nil {
+			log.Fatal("get claim error: ", err)
+		}
+		switch result.Status {
+		case "confirmed":
+			fmt.Println("confirmed, tx hash:", result.TxHash)
+			return
+		case "failed", "expired":
+			log.Fatalf("claim %s: %s", result.Status, result.Error)
+		}
+		if time.Now().After(deadline) {
+			log.Fatalf("claim is still %s after %s", result.Status, *wait)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// call 调用水龙头的接口，接口返回错误时返回*apiError
+func call(method, path string, body, result interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, baseUrl+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		e := &apiError{}
+		if err = json.Unmarshal(data, e); err != nil || e.Code == "" {
+			return fmt.Errorf("http status %s", resp.Status)
+		}
+		return e
+	}
+	return json.Unmarshal(data, result)
+}
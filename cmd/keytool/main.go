@@ -0,0 +1,190 @@
+// keytool 管理水龙头打币账户的keystore文件
+//
+//	keytool new    -out faucet.json [-passfile pass.txt] [-light] [-kdf scrypt|pbkdf2]
+//	keytool import -out faucet.json -key <hex私钥文件> [-passfile pass.txt]
+//	keytool export -in faucet.json [-passfile pass.txt]
+//	keytool address -in faucet.json
+//
+// 密码优先读取 -passfile，其次读取环境变量 LEMO_FAUCET_PASSPHRASE，都没有则从标准输入读取一行
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"flag"
+	"fmt"
+	"github.com/lemoTestCoin/common"
+	"github.com/lemoTestCoin/common/crypto"
+	"github.com/lemoTestCoin/config"
+	"github.com/lemoTestCoin/keystore"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: keytool <new|import|export|address> [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+	var err error
+	switch cmd {
+	case "new":
+		err = newKey(args)
+	case "import":
+		err = importKey(args)
+	case "export":
+		err = exportKey(args)
+	case "address":
+		err = showAddress(args)
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(cmd, " error: ", err)
+	}
+}
+
+// encryptFlags new和import共用的参数
+type encryptFlags struct {
+	out      *string
+	passFile *string
+	light    *bool
+	kdf      *string
+}
+
+func addEncryptFlags(fs *flag.FlagSet) *encryptFlags {
+	return &encryptFlags{
+		out:      fs.String("out", "", "输出的keystore文件"),
+		passFile: fs.String("passfile", "", "密码文件"),
+		light:    fs.Bool("light", false, "使用轻量的scrypt参数，只用于测试"),
+		kdf:      fs.String("kdf", keystore.KdfScrypt, "密钥派生算法 scrypt 或 pbkdf2"),
+	}
+}
+
+func (f *encryptFlags) store(key *ecdsa.PrivateKey) error {
+	if *f.out == "" {
+		return fmt.Errorf("-out is required")
+	}
+	passphrase, err := readPassphrase(*f.passFile, true)
+	if err != nil {
+		return err
+	}
+	opts := keystore.Options{KDF: *f.kdf}
+	if *f.light {
+		opts.ScryptN, opts.ScryptP = keystore.LightScryptN, keystore.LightScryptP
+	}
+	if err = keystore.StoreKey(*f.out, key, passphrase, opts); err != nil {
+		return err
+	}
+	fmt.Println("address:", crypto.PubkeyToAddress(key.PublicKey).String())
+	fmt.Println("keystore:", *f.out)
+	return nil
+}
+
+// newKey 生成新的打币账户
+func newKey(args []string) error {
+	fs := flag.NewFlagSet("new", flag.ExitOnError)
+	ef := addEncryptFlags(fs)
+	fs.Parse(args)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	return ef.store(key)
+}
+
+// importKey 把明文私钥文件导入为keystore
+func importKey(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	ef := addEncryptFlags(fs)
+	keyFile := fs.String("key", "", "十六进制明文私钥文件")
+	fs.Parse(args)
+	if *keyFile == "" {
+		return fmt.Errorf("-key is required")
+	}
+	data, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return err
+	}
+	return ef.store(key)
+}
+
+// exportKey 解密keystore并输出明文私钥
+func exportKey(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	in := fs.String("in", "", "keystore文件")
+	passFile := fs.String("passfile", "", "密码文件")
+	fs.Parse(args)
+	if *in == "" {
+		return fmt.Errorf("-in is required")
+	}
+	passphrase, err := readPassphrase(*passFile, false)
+	if err != nil {
+		return err
+	}
+	key, err := keystore.LoadKey(*in, passphrase)
+	if err != nil {
+		return err
+	}
+	fmt.Println(common.ToHex(crypto.FromECDSA(key)))
+	return nil
+}
+
+// showAddress 输出keystore的地址，不需要密码
+func showAddress(args []string) error {
+	fs := flag.NewFlagSet("address", flag.ExitOnError)
+	in := fs.String("in", "", "keystore文件")
+	fs.Parse(args)
+	data, err := ioutil.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	address, err := keystore.KeyAddress(data)
+	if err != nil {
+		return err
+	}
+	fmt.Println(address)
+	return nil
+}
+
+// readPassphrase 读取密码，新建时从标准输入读取需要输入两次确认
+func readPassphrase(passFile string, confirm bool) (string, error) {
+	passphrase, err := keystore.ReadPassphrase(passFile, config.PassphraseEnv)
+	if err != keystore.ErrNoPassphrase {
+		return passphrase, err
+	}
+	reader := bufio.NewReader(os.Stdin)
+	readLine := func(prompt string) (string, error) {
+		fmt.Fprint(os.Stderr, prompt)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	if passphrase, err = readLine("Passphrase: "); err != nil {
+		return "", err
+	}
+	if confirm {
+		again, err := readLine("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
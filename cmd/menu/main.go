@@ -0,0 +1,177 @@
+// menu 管理公众号的自定义菜单
+//
+//	menu -config faucet.json -file menu.json sync   用菜单文件替换公众号的默认菜单和全部个性化菜单
+//	menu -config faucet.json get                    打印公众号当前的菜单
+//	menu -config faucet.json delete                 删除默认菜单和全部个性化菜单
+//
+// 菜单文件的格式与微信查询菜单接口返回的格式相同，见 config/menu.example.json。
+// 个性化菜单的 matchrule 可以用 "tag" 写标签名，同步时查找对应的 tag_id。
+// 获取access_token会使正在运行的水龙头的access_token在5分钟后失效，水龙头会自动刷新
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lemoTestCoin/config"
+	"github.com/lemoTestCoin/manager"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+)
+
+// 菜单文件中的个性化菜单，matchrule中可以用标签名代替tag_id
+type fileMenu struct {
+	Button    []*manager.Button `json:"button"`
+	MatchRule *fileMatchRule    `json:"matchrule,omitempty"`
+}
+type fileMatchRule struct {
+	manager.MatchRule
+	Tag string `json:"tag,omitempty"`
+}
+
+// 菜单文件
+type menuFile struct {
+	Menu            *manager.Menu `json:"menu"`
+	ConditionalMenu []*fileMenu   `json:"conditionalmenu"`
+}
+
+func main() {
+	log.SetFlags(0)
+	configPath := flag.String("config", "", "水龙头的配置文件(json)，环境变量 LEMO_FAUCET_* 会覆盖配置文件中的值")
+	file := flag.String("file", "menu.json", "sync 使用的菜单文件")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: menu -config faucet.json [-file menu.json] sync|get|delete")
+		os.Exit(2)
+	}
+	cmd := flag.Arg(0)
+	if cmd != "sync" && cmd != "get" && cmd != "delete" {
+		log.Fatal("unknown command: ", cmd)
+	}
+
+	// 先检查菜单文件，避免删除了菜单之后才发现文件有错
+	var menus *menuFile
+	if cmd == "sync" {
+		var err error
+		if menus, err = loadMenuFile(*file); err != nil {
+			log.Fatalf("load menu file %s error: %v", *file, err)
+		}
+	}
+
+	conf, err := config.Load(*configPath, nil)
+	if err != nil {
+		log.Fatal("load config error: ", err)
+	}
+	tokens := manager.NewTokenManager(conf.WeChat.AppID, conf.WeChat.AppSecret)
+	if err = tokens.Start(); err != nil {
+		log.Fatal("get access_token error: ", err)
+	}
+	defer tokens.Stop()
+
+	switch cmd {
+	case "sync":
+		err = syncMenu(tokens, menus)
+	case "get":
+		err = printMenu(tokens)
+	case "delete":
+		err = manager.DeleteMenu(tokens)
+	}
+	if err != nil {
+		log.Fatalf("%s menu error: %v", cmd, err)
+	}
+}
+
+// loadMenuFile 读取并检查菜单文件
+func loadMenuFile(path string) (*menuFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	menus := &menuFile{}
+	if err = json.Unmarshal(data, menus); err != nil {
+		return nil, err
+	}
+	if menus.Menu == nil {
+		return nil, fmt.Errorf("no default menu")
+	}
+	if err = menus.Menu.Validate(); err != nil {
+		return nil, err
+	}
+	for i, menu := range menus.ConditionalMenu {
+		if menu.MatchRule == nil {
+			return nil, fmt.Errorf("conditional menu %d has no matchrule", i)
+		}
+		if err = (&manager.Menu{Button: menu.Button}).Validate(); err != nil {
+			return nil, fmt.Errorf("conditional menu %d: %v", i, err)
+		}
+	}
+	return menus, nil
+}
+
+// syncMenu 删除公众号现有的菜单，再创建文件中的默认菜单和个性化菜单
+func syncMenu(tokens *manager.TokenManager, menus *menuFile) error {
+	tagIds, err := tagIds(tokens, menus.ConditionalMenu)
+	if err != nil {
+		return err
+	}
+	if err = manager.DeleteMenu(tokens); err != nil {
+		return err
+	}
+	if err = manager.CreateMenu(tokens, menus.Menu); err != nil {
+		return err
+	}
+	fmt.Println("default menu created")
+	for _, menu := range menus.ConditionalMenu {
+		rule := menu.MatchRule.MatchRule
+		if menu.MatchRule.Tag != "" {
+			rule.TagId = tagIds[menu.MatchRule.Tag]
+		}
+		menuId, err := manager.AddConditionalMenu(tokens, &manager.Menu{Button: menu.Button, MatchRule: &rule})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("conditional menu %s created, matchrule %+v\n", menuId, rule)
+	}
+	return nil
+}
+
+// tagIds 查找个性化菜单中用到的标签名对应的tag_id
+func tagIds(tokens *manager.TokenManager, menus []*fileMenu) (map[string]string, error) {
+	ids := make(map[string]string)
+	needed := false
+	for _, menu := range menus {
+		needed = needed || menu.MatchRule.Tag != ""
+	}
+	if !needed {
+		return ids, nil
+	}
+	tags, err := manager.ListTags(tokens)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		ids[tag.Name] = strconv.Itoa(tag.Id)
+	}
+	for _, menu := range menus {
+		if tag := menu.MatchRule.Tag; tag != "" && ids[tag] == "" {
+			return nil, fmt.Errorf("tag %s does not exist", tag)
+		}
+	}
+	return ids, nil
+}
+
+// printMenu 打印公众号当前的菜单
+func printMenu(tokens *manager.TokenManager) error {
+	menus, err := manager.GetMenu(tokens)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(menus, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,74 @@
+// qrcode 为推广渠道生成带参数的公众号二维码，用户扫码后水龙头会记录带来用户和申请的渠道
+//
+//	qrcode -config faucet.json [-expire 0] [-out qrcodes] <场景值>...
+//
+// 每个场景值生成一张二维码图片 <场景值>.jpg，-expire 为0时生成永久二维码，否则为临时二维码的有效期(秒，最长30天)。
+// 整数场景值使用整型场景值(永久二维码为1到100000)，其他使用字符串场景值(最长64个字符)。
+// 获取access_token会使正在运行的水龙头的access_token在5分钟后失效，水龙头会自动刷新
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/lemoTestCoin/config"
+	"github.com/lemoTestCoin/manager"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	log.SetFlags(0)
+	configPath := flag.String("config", "", "水龙头的配置文件(json)，环境变量 LEMO_FAUCET_* 会覆盖配置文件中的值")
+	expire := flag.Int("expire", 0, "临时二维码的有效期(秒)，0表示永久二维码")
+	out := flag.String("out", ".", "二维码图片保存的目录")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: qrcode -config faucet.json [-expire 0] [-out dir] <scene>...")
+		os.Exit(2)
+	}
+
+	conf, err := config.Load(*configPath, nil)
+	if err != nil {
+		log.Fatal("load config error: ", err)
+	}
+	if err = os.MkdirAll(*out, 0755); err != nil {
+		log.Fatal(err)
+	}
+	tokens := manager.NewTokenManager(conf.WeChat.AppID, conf.WeChat.AppSecret)
+	if err = tokens.Start(); err != nil {
+		log.Fatal("get access_token error: ", err)
+	}
+	defer tokens.Stop()
+
+	for _, scene := range flag.Args() {
+		if err = createQRCode(tokens, scene, *expire, *out); err != nil {
+			log.Fatalf("create qrcode for scene %s error: %v", scene, err)
+		}
+	}
+}
+
+// createQRCode 生成一个场景值的二维码并保存图片
+func createQRCode(tokens *manager.TokenManager, scene string, expire int, out string) error {
+	qrcode, err := manager.CreateQRCode(tokens, scene, expire)
+	if err != nil {
+		return err
+	}
+	image, err := manager.ShowQRCode(qrcode.Ticket)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(out, filepath.Base(scene)+".jpg")
+	if err = ioutil.WriteFile(path, image, 0644); err != nil {
+		return err
+	}
+	fmt.Println("scene:", scene)
+	fmt.Println("  image:", path)
+	fmt.Println("  url:", qrcode.Url)
+	fmt.Println("  showqrcode:", manager.QRCodeImageUrl(qrcode.Ticket))
+	if qrcode.ExpireSeconds > 0 {
+		fmt.Println("  expire seconds:", qrcode.ExpireSeconds)
+	}
+	return nil
+}
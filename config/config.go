@@ -0,0 +1,455 @@
+// 水龙头的配置，支持配置文件和环境变量覆盖，启动时校验
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 环境变量前缀，例如 LEMO_FAUCET_APP_ID
+const envPrefix = "LEMO_FAUCET_"
+
+// 微信公众号相关配置
+type WeChatConfig struct {
+	Token     string `json:"token"`     // 用于验证来自绑定的微信公众号的请求的token，与公众号中的设置相同
+	AppID     string `json:"appId"`     // 绑定公众号的appid
+	AppSecret string `json:"appSecret"` // 绑定公众号的app秘钥
+	TagName   string `json:"tagName"`   // 未配置tagRules时，第一次申请到账的微信用户打上的标签
+
+	EncryptMode    string `json:"encryptMode"`    // 消息加解密方式: plaintext(明文模式)、compatible(兼容模式)、safe(安全模式)
+	EncodingAESKey string `json:"encodingAESKey"` // 消息加解密密钥，兼容模式和安全模式下必填
+
+	RepliesFile string `json:"repliesFile"` // 关键词自动回复的规则文件，修改后自动重新加载，为空则使用默认回复
+
+	TagRules []TagRule `json:"tagRules"` // 给微信用户打标签的规则，为空时使用 第一次申请到账打上tagName标签
+
+	PayoutTemplate TemplateConfig `json:"payoutTemplate"` // 测试币到账通知的模板消息
+}
+
+// 模板消息配置
+type TemplateConfig struct {
+	Id  string `json:"id"`  // 公众号中添加的模板id，为空则不发送模板消息，改为发送客服消息
+	Url string `json:"url"` // 点击消息打开的网页，{txHash}和{address}会被替换为交易hash和地址，可以为空
+}
+
+// 给微信用户打标签的规则，claims和scene只能设置一个
+type TagRule struct {
+	Tag    string `json:"tag"`    // 标签名，不存在时启动时自动创建
+	Claims uint64 `json:"claims"` // 用户申请的测试币到账时，申请次数达到claims次则打标签，1表示第一次申请到账
+	Scene  string `json:"scene"`  // 用户扫场景值为scene的二维码后打标签
+}
+
+// 水龙头打币相关配置
+type FaucetConfig struct {
+	Amount   string `json:"amount"`   // 每次打币的数量，单位为mo，10 LEMO = 10000000000000000000
+	Interval uint64 `json:"interval"` // 每个lemo地址限制申请测试币的间隔时间，单位秒
+
+	UserInterval   uint64 `json:"userInterval"`   // 每个微信用户(openid)限制申请测试币的间隔时间，单位秒，0表示不限制
+	UserDailyQuota uint64 `json:"userDailyQuota"` // 每个微信用户每天最多申请的次数，0表示不限制
+
+	HourlyCap string `json:"hourlyCap"` // 每小时最多发放的测试币，单位为mo，空表示不限制
+	DailyCap  string `json:"dailyCap"`  // 每天最多发放的测试币，单位为mo，空表示不限制
+}
+
+// http json接口配置，用于没有微信的开发者和CI脚本申请测试币
+type APIConfig struct {
+	Enabled      bool   `json:"enabled"`      // 是否开启 /api/v1/ 接口
+	IPInterval   uint64 `json:"ipInterval"`   // 每个客户端ip限制申请测试币的间隔时间，单位秒，0表示不限制
+	IPDailyQuota uint64 `json:"ipDailyQuota"` // 每个客户端ip每天最多申请的次数，0表示不限制
+	RateLimit    uint64 `json:"rateLimit"`    // 每个客户端ip每分钟最多请求接口的次数，0表示不限制
+	TrustProxy   bool   `json:"trustProxy"`   // 从nginx设置的 X-Real-IP / X-Forwarded-For 读取客户端ip，只有部署在反向代理后面时才能打开
+	RequirePoW   bool   `json:"requirePoW"`   // 申请前需要完成工作量证明，题目从 GET /api/v1/challenge 获取
+}
+
+// 网页配置，网页申请按客户端ip限制，限制与http json接口相同，申请前必须完成工作量证明
+type WebConfig struct {
+	Enabled bool `json:"enabled"` // 是否在 /faucet/ 提供网页
+}
+
+// 工作量证明配置，网页和开启了requirePoW的http接口使用
+type PoWConfig struct {
+	Difficulty    int    `json:"difficulty"`    // 基础难度，hash前导0的bit数，每加1客户端的计算量翻倍
+	MaxDifficulty int    `json:"maxDifficulty"` // 按申请量自动提高后的最大难度
+	ChallengeTTL  uint64 `json:"challengeTTL"`  // 题目的有效期，单位秒
+	ScaleWindow   uint64 `json:"scaleWindow"`   // 统计最近多长时间内网页和http接口的申请量，单位秒
+	ScaleClaims   uint64 `json:"scaleClaims"`   // scaleWindow内的申请数达到scaleClaims时难度加1，之后每翻一倍再加1，0表示不自动提高
+	RateLimit     uint64 `json:"rateLimit"`     // 每个客户端ip每分钟最多获取题目的次数，0表示不限制
+}
+
+// PoWEnabled 网页或者http接口需要工作量证明
+func (c *Config) PoWEnabled() bool {
+	return c.Web.Enabled || (c.API.Enabled && c.API.RequirePoW)
+}
+
+// 运维接口配置
+type OpsConfig struct {
+	Token  string   `json:"token"`  // 访问 /ops/ 接口需要的token，为空则不开启运维接口
+	Admins []string `json:"admins"` // 可以在公众号中发送管理指令的微信用户openid，为空则不开启管理指令
+}
+
+// 链相关配置
+type ChainConfig struct {
+	NodeUrl        string   `json:"nodeUrl"`        // 连接的节点的地址，与NodeUrls合并，排在第一个
+	NodeUrls       []string `json:"nodeUrls"`       // 连接的多个节点的地址，第一个为初始的主节点
+	Timeout        uint64   `json:"timeout"`        // 单个rpc请求的超时时间，单位秒
+	HealthInterval uint64   `json:"healthInterval"` // 节点健康检查的间隔，单位秒
+	ChainID        uint16   `json:"chainID"`        // 链id
+	SenderAddress  string   `json:"senderAddress"`  // 打币账户地址，使用keystore时可以不填，填写时必须与keystore中的地址一致
+	Keystore       string   `json:"keystore"`       // 打币账户的加密keystore文件
+	PassphraseFile string   `json:"passphraseFile"` // keystore密码文件，不填则读取环境变量 LEMO_FAUCET_PASSPHRASE
+	SenderPrivate  string   `json:"senderPrivate"`  // 明文的打币账户私钥，仅在 InsecureRawKey 为true时允许使用
+	InsecureRawKey bool     `json:"insecureRawKey"` // 允许使用明文私钥启动，只应在本地开发环境中打开
+}
+
+// PassphraseEnv 存放keystore密码的环境变量
+const PassphraseEnv = envPrefix + "PASSPHRASE"
+
+type Config struct {
+	Listen string       `json:"listen"` // 服务监听地址，服务器上nginx反代理到此端口
+	DBPath string       `json:"dbPath"` // bolt数据库文件
+	WeChat WeChatConfig `json:"wechat"`
+	Faucet FaucetConfig `json:"faucet"`
+	Chain  ChainConfig  `json:"chain"`
+	Ops    OpsConfig    `json:"ops"`
+	API    APIConfig    `json:"api"`
+	Web    WebConfig    `json:"web"`
+	PoW    PoWConfig    `json:"pow"`
+
+	amount    *big.Int
+	hourlyCap *big.Int
+	dailyCap  *big.Int
+}
+
+// Default 返回默认配置，未在配置文件和环境变量中设置的字段使用默认值
+func Default() *Config {
+	return &Config{
+		Listen: ":8088",
+		DBPath: "bolt.db",
+		WeChat: WeChatConfig{
+			TagName:     "开发者",
+			EncryptMode: "plaintext",
+		},
+		Faucet: FaucetConfig{
+			Amount:   "10000000000000000000", // 10 lemo
+			Interval: 24 * 3600,              // 一天
+
+			UserInterval:   24 * 3600,
+			UserDailyQuota: 1,
+		},
+		API: APIConfig{
+			IPInterval:   24 * 3600,
+			IPDailyQuota: 1,
+			RateLimit:    30,
+		},
+		PoW: PoWConfig{
+			Difficulty:    16,
+			MaxDifficulty: 22,
+			ChallengeTTL:  300,
+			ScaleWindow:   3600,
+			ScaleClaims:   50,
+			RateLimit:     10,
+		},
+		Chain: ChainConfig{
+			ChainID:        100,
+			Timeout:        10,
+			HealthInterval: 30,
+		},
+	}
+}
+
+// Load 读取配置文件(path为空则只使用默认值)，再用环境变量覆盖，最后校验配置。
+// override不为nil时在校验之前调用，用于命令行参数覆盖，优先级最高
+func Load(path string, override func(*Config)) (*Config, error) {
+	conf := Default()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config file error: %v", err)
+		}
+		if err = json.Unmarshal(data, conf); err != nil {
+			return nil, fmt.Errorf("parse config file %s error: %v", path, err)
+		}
+	}
+	if err := conf.applyEnv(); err != nil {
+		return nil, err
+	}
+	if override != nil {
+		override(conf)
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// envString 用环境变量 LEMO_FAUCET_<name> 覆盖字符串配置
+func envString(name string, field *string) {
+	if v, ok := os.LookupEnv(envPrefix + name); ok {
+		*field = v
+	}
+}
+
+// envUint 用环境变量 LEMO_FAUCET_<name> 覆盖整数配置
+func envUint(name string, bitSize int, set func(uint64)) error {
+	v, ok := os.LookupEnv(envPrefix + name)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(v), 10, bitSize)
+	if err != nil {
+		return fmt.Errorf("invalid env %s%s: %v", envPrefix, name, err)
+	}
+	set(n)
+	return nil
+}
+
+// envBool 用环境变量 LEMO_FAUCET_<name> 覆盖布尔配置
+func envBool(name string, field *bool) error {
+	v, ok := os.LookupEnv(envPrefix + name)
+	if !ok {
+		return nil
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return fmt.Errorf("invalid env %s%s: %v", envPrefix, name, err)
+	}
+	*field = b
+	return nil
+}
+
+// applyEnv 环境变量优先级高于配置文件
+func (c *Config) applyEnv() error {
+	envString("LISTEN", &c.Listen)
+	envString("DB_PATH", &c.DBPath)
+	envString("WECHAT_TOKEN", &c.WeChat.Token)
+	envString("APP_ID", &c.WeChat.AppID)
+	envString("APP_SECRET", &c.WeChat.AppSecret)
+	envString("TAG_NAME", &c.WeChat.TagName)
+	envString("ENCRYPT_MODE", &c.WeChat.EncryptMode)
+	envString("ENCODING_AES_KEY", &c.WeChat.EncodingAESKey)
+	envString("REPLIES_FILE", &c.WeChat.RepliesFile)
+	envString("PAYOUT_TEMPLATE_ID", &c.WeChat.PayoutTemplate.Id)
+	envString("PAYOUT_TEMPLATE_URL", &c.WeChat.PayoutTemplate.Url)
+	envString("AMOUNT", &c.Faucet.Amount)
+	envString("HOURLY_CAP", &c.Faucet.HourlyCap)
+	envString("DAILY_CAP", &c.Faucet.DailyCap)
+	envString("OPS_TOKEN", &c.Ops.Token)
+	if v, ok := os.LookupEnv(envPrefix + "OPS_ADMINS"); ok {
+		c.Ops.Admins = strings.Split(v, ",")
+	}
+	envString("NODE_URL", &c.Chain.NodeUrl)
+	if v, ok := os.LookupEnv(envPrefix + "NODE_URLS"); ok {
+		c.Chain.NodeUrls = strings.Split(v, ",")
+	}
+	envString("SENDER_ADDRESS", &c.Chain.SenderAddress)
+	envString("SENDER_PRIVATE", &c.Chain.SenderPrivate)
+	envString("KEYSTORE", &c.Chain.Keystore)
+	envString("PASSPHRASE_FILE", &c.Chain.PassphraseFile)
+	if err := envBool("INSECURE_RAW_KEY", &c.Chain.InsecureRawKey); err != nil {
+		return err
+	}
+	if err := envBool("API_ENABLED", &c.API.Enabled); err != nil {
+		return err
+	}
+	if err := envBool("API_TRUST_PROXY", &c.API.TrustProxy); err != nil {
+		return err
+	}
+	if err := envBool("WEB_ENABLED", &c.Web.Enabled); err != nil {
+		return err
+	}
+	if err := envBool("API_REQUIRE_POW", &c.API.RequirePoW); err != nil {
+		return err
+	}
+	if err := envUint("POW_DIFFICULTY", 8, func(n uint64) { c.PoW.Difficulty = int(n) }); err != nil {
+		return err
+	}
+	if err := envUint("POW_MAX_DIFFICULTY", 8, func(n uint64) { c.PoW.MaxDifficulty = int(n) }); err != nil {
+		return err
+	}
+	if err := envUint("POW_CHALLENGE_TTL", 64, func(n uint64) { c.PoW.ChallengeTTL = n }); err != nil {
+		return err
+	}
+	if err := envUint("POW_SCALE_WINDOW", 64, func(n uint64) { c.PoW.ScaleWindow = n }); err != nil {
+		return err
+	}
+	if err := envUint("POW_SCALE_CLAIMS", 64, func(n uint64) { c.PoW.ScaleClaims = n }); err != nil {
+		return err
+	}
+	if err := envUint("POW_RATE_LIMIT", 64, func(n uint64) { c.PoW.RateLimit = n }); err != nil {
+		return err
+	}
+	if err := envUint("API_IP_INTERVAL", 64, func(n uint64) { c.API.IPInterval = n }); err != nil {
+		return err
+	}
+	if err := envUint("API_IP_DAILY_QUOTA", 64, func(n uint64) { c.API.IPDailyQuota = n }); err != nil {
+		return err
+	}
+	if err := envUint("API_RATE_LIMIT", 64, func(n uint64) { c.API.RateLimit = n }); err != nil {
+		return err
+	}
+	if err := envUint("INTERVAL", 64, func(n uint64) { c.Faucet.Interval = n }); err != nil {
+		return err
+	}
+	if err := envUint("USER_INTERVAL", 64, func(n uint64) { c.Faucet.UserInterval = n }); err != nil {
+		return err
+	}
+	if err := envUint("USER_DAILY_QUOTA", 64, func(n uint64) { c.Faucet.UserDailyQuota = n }); err != nil {
+		return err
+	}
+	if err := envUint("RPC_TIMEOUT", 64, func(n uint64) { c.Chain.Timeout = n }); err != nil {
+		return err
+	}
+	if err := envUint("HEALTH_INTERVAL", 64, func(n uint64) { c.Chain.HealthInterval = n }); err != nil {
+		return err
+	}
+	return envUint("CHAIN_ID", 16, func(n uint64) { c.Chain.ChainID = uint16(n) })
+}
+
+// Validate 校验配置是否完整可用
+func (c *Config) Validate() error {
+	var missing []string
+	check := func(name, value string) {
+		if strings.TrimSpace(value) == "" {
+			missing = append(missing, name)
+		}
+	}
+	check("listen", c.Listen)
+	check("dbPath", c.DBPath)
+	check("wechat.token", c.WeChat.Token)
+	check("wechat.appId", c.WeChat.AppID)
+	check("wechat.appSecret", c.WeChat.AppSecret)
+	check("wechat.tagName", c.WeChat.TagName)
+	c.Chain.NodeUrls = mergeNodeUrls(c.Chain.NodeUrl, c.Chain.NodeUrls)
+	if len(c.Chain.NodeUrls) == 0 {
+		missing = append(missing, "chain.nodeUrls")
+	}
+	if c.Chain.Keystore == "" {
+		check("chain.keystore", c.Chain.SenderPrivate)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing config: %s", strings.Join(missing, ", "))
+	}
+	if c.Chain.Keystore == "" && !c.Chain.InsecureRawKey {
+		return errors.New("refuse to use raw chain.senderPrivate without chain.insecureRawKey, use chain.keystore instead")
+	}
+	if c.Chain.Keystore != "" && c.Chain.SenderPrivate != "" {
+		return errors.New("chain.keystore and chain.senderPrivate can not be both set")
+	}
+
+	amount, ok := new(big.Int).SetString(c.Faucet.Amount, 10)
+	if !ok || amount.Sign() <= 0 {
+		return fmt.Errorf("invalid faucet.amount: %q", c.Faucet.Amount)
+	}
+	c.amount = amount
+	var err error
+	if c.hourlyCap, err = parseCap("faucet.hourlyCap", c.Faucet.HourlyCap, amount); err != nil {
+		return err
+	}
+	if c.dailyCap, err = parseCap("faucet.dailyCap", c.Faucet.DailyCap, amount); err != nil {
+		return err
+	}
+	if c.Faucet.Interval == 0 {
+		return errors.New("faucet.interval must be greater than 0")
+	}
+	switch c.WeChat.EncryptMode {
+	case "plaintext":
+	case "compatible", "safe":
+		if len(c.WeChat.EncodingAESKey) != 43 {
+			return fmt.Errorf("wechat.encodingAESKey must be 43 characters in %s mode", c.WeChat.EncryptMode)
+		}
+	default:
+		return fmt.Errorf("invalid wechat.encryptMode: %q", c.WeChat.EncryptMode)
+	}
+	if len(c.WeChat.TagRules) == 0 {
+		c.WeChat.TagRules = []TagRule{{Tag: c.WeChat.TagName, Claims: 1}}
+	}
+	for i, rule := range c.WeChat.TagRules {
+		if strings.TrimSpace(rule.Tag) == "" {
+			return fmt.Errorf("wechat.tagRules[%d].tag is empty", i)
+		}
+		if (rule.Claims > 0) == (rule.Scene != "") {
+			return fmt.Errorf("wechat.tagRules[%d] must set one of claims and scene", i)
+		}
+	}
+	var admins []string
+	for _, openid := range c.Ops.Admins {
+		if openid = strings.TrimSpace(openid); openid != "" {
+			admins = append(admins, openid)
+		}
+	}
+	c.Ops.Admins = admins
+	if c.PoWEnabled() {
+		if c.PoW.Difficulty < 1 || c.PoW.MaxDifficulty < c.PoW.Difficulty || c.PoW.MaxDifficulty > 32 {
+			return fmt.Errorf("pow difficulty must satisfy 1 <= difficulty(%d) <= maxDifficulty(%d) <= 32", c.PoW.Difficulty, c.PoW.MaxDifficulty)
+		}
+		if c.PoW.ChallengeTTL == 0 {
+			return errors.New("pow.challengeTTL must be greater than 0")
+		}
+		if c.PoW.ScaleClaims > 0 && c.PoW.ScaleWindow == 0 {
+			return errors.New("pow.scaleWindow must be greater than 0 when pow.scaleClaims is set")
+		}
+	}
+	if c.Chain.ChainID == 0 {
+		return errors.New("chain.chainID must be greater than 0")
+	}
+	for _, url := range c.Chain.NodeUrls {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return fmt.Errorf("invalid chain node url: %q", url)
+		}
+	}
+	return nil
+}
+
+// mergeNodeUrls 合并nodeUrl和nodeUrls，去掉空的和重复的地址
+func mergeNodeUrls(first string, urls []string) []string {
+	var merged []string
+	seen := make(map[string]bool)
+	for _, url := range append([]string{first}, urls...) {
+		url = strings.TrimSpace(url)
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		merged = append(merged, url)
+	}
+	return merged
+}
+
+// parseCap 解析发放上限，上限不能小于每次打币的数量
+func parseCap(name, value string, amount *big.Int) (*big.Int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	limit, ok := new(big.Int).SetString(value, 10)
+	if !ok || limit.Cmp(amount) < 0 {
+		return nil, fmt.Errorf("invalid %s: %q, must be a number not less than faucet.amount", name, value)
+	}
+	return limit, nil
+}
+
+// HourlyCapInt 每小时发放上限，nil表示不限制，Validate之后可用
+func (c *Config) HourlyCapInt() *big.Int {
+	return c.hourlyCap
+}
+
+// DailyCapInt 每天发放上限，nil表示不限制，Validate之后可用
+func (c *Config) DailyCapInt() *big.Int {
+	return c.dailyCap
+}
+
+// AmountInt 每次打币的数量，Validate之后可用
+func (c *Config) AmountInt() *big.Int {
+	return new(big.Int).Set(c.amount)
+}
+
+// IntervalDuration 同一地址两次申请的间隔
+func (c *Config) IntervalDuration() time.Duration {
+	return time.Duration(c.Faucet.Interval) * time.Second
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `{
+  "listen": ":1001",
+  "dbPath": "file.db",
+  "wechat": {"token": "token", "appId": "appid", "appSecret": "secret"},
+  "chain": {"nodeUrls": ["http://127.0.0.1:8001"], "keystore": "data/faucet.json"}
+}`
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "faucet.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 优先级: 命令行参数 > 环境变量 > 配置文件 > 默认值
+func TestLoadOverrideOrder(t *testing.T) {
+	path := writeConfig(t, testConfig)
+	conf, err := Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Listen != ":1001" || conf.DBPath != "file.db" || conf.WeChat.TagName != "开发者" {
+		t.Fatalf("listen %q, dbPath %q, tagName %q", conf.Listen, conf.DBPath, conf.WeChat.TagName)
+	}
+
+	t.Setenv(envPrefix+"LISTEN", ":1002")
+	t.Setenv(envPrefix+"CHAIN_ID", "7")
+	if conf, err = Load(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Listen != ":1002" || conf.DBPath != "file.db" || conf.Chain.ChainID != 7 {
+		t.Fatalf("env override: listen %q, dbPath %q, chainID %d", conf.Listen, conf.DBPath, conf.Chain.ChainID)
+	}
+
+	if conf, err = Load(path, func(c *Config) { c.Listen = ":1003" }); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Listen != ":1003" {
+		t.Fatalf("flag override: listen %q, want :1003", conf.Listen)
+	}
+
+	t.Setenv(envPrefix+"CHAIN_ID", "70000")
+	if _, err = Load(path, nil); err == nil || !strings.Contains(err.Error(), envPrefix+"CHAIN_ID") {
+		t.Fatalf("invalid env returned %v", err)
+	}
+}
+
+// 明文私钥必须明确打开insecureRawKey，且不能与keystore同时配置
+func TestValidateRawKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		keystore  string
+		private   string
+		insecure  bool
+		wantError string
+	}{
+		{name: "keystore", keystore: "data/faucet.json"},
+		{name: "raw key", private: "0x01", wantError: "insecureRawKey"},
+		{name: "insecure raw key", private: "0x01", insecure: true},
+		{name: "both", keystore: "data/faucet.json", private: "0x01", insecure: true, wantError: "both"},
+		{name: "none", insecure: true, wantError: "missing config: chain.keystore"},
+	}
+	for _, test := range tests {
+		path := writeConfig(t, testConfig)
+		_, err := Load(path, func(c *Config) {
+			c.Chain.Keystore, c.Chain.SenderPrivate, c.Chain.InsecureRawKey = test.keystore, test.private, test.insecure
+		})
+		if test.wantError == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.wantError) {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.wantError)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lemoTestCoin/store"
+	"github.com/lemoTestCoin/types"
+	"log"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 运维操作，/ops/ 接口和公众号中的管理指令共用。操作人by记录在日志和申请记录中
+
+// 管理指令的前缀，只有配置在 ops.admins 中的微信用户发送的加密消息才会执行:
+//
+//	#状态                      打币状态、打币账户余额和发放额度
+//	#暂停 [原因]               暂停打币
+//	#恢复                      恢复打币
+//	#记录 <地址|openid|ip>     最近的申请记录
+//	#重置 <地址|openid|ip>     重置申请间隔
+//	#拉黑 <地址|openid|ip> [原因]     #取消拉黑 <地址|openid|ip> [原因]
+//	#白名单 <地址|openid|ip> [间隔秒数|不限] [原因]   #取消白名单 <地址|openid|ip> [原因]
+//	#打币 <地址>               手动打币
+const adminPrefix = "#"
+
+// 管理指令查询申请记录的条数，被动回复的消息不能太长
+const adminHistoryLimit = 5
+
+// faucetStatus 水龙头的运行状态
+type faucetStatus struct {
+	Pause   *store.PauseState  `json:"pause"`
+	Sender  string             `json:"sender"`  // 打币账户地址
+	Balance string             `json:"balance"` // 打币账户的余额，查询失败时为空
+	Budget  *store.BudgetUsage `json:"budget"`
+}
+
+// adminTarget 按内容判断运维操作的对象是Lemo地址、ip还是微信用户的openid
+func adminTarget(value string) string {
+	if fromLemoAddress(value) {
+		return store.TargetAddress
+	}
+	if net.ParseIP(value) != nil {
+		return store.TargetIP
+	}
+	return store.TargetOpenID
+}
+
+// getStatus 查询打币状态、打币账户余额和当前的发放额度
+func getStatus() (*faucetStatus, error) {
+	pause, err := db.PauseState()
+	if err != nil {
+		return nil, err
+	}
+	usage, err := db.BudgetUsage(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	status := &faucetStatus{Pause: pause, Sender: types.SenderAddress(), Budget: usage}
+	if status.Balance, err = types.GetBalance(status.Sender); err != nil {
+		log.Println("get sender balance error:", err)
+	}
+	return status, nil
+}
+
+// pausePayouts 暂停或者恢复打币，恢复后立即处理队列中的申请
+func pausePayouts(paused bool, reason, by string) error {
+	if err := db.SetPaused(paused, reason, by, time.Now()); err != nil {
+		return err
+	}
+	if paused {
+		log.Printf("admin: %s paused payouts: %s\n", by, reason)
+	} else {
+		log.Printf("admin: %s resumed payouts\n", by)
+		payoutWorker.Wake()
+	}
+	return nil
+}
+
+// resetCooldown 重置地址、微信用户或ip的申请间隔
+func resetCooldown(value, by string) error {
+	target := adminTarget(value)
+	if err := db.ResetCooldown(target, value); err != nil {
+		return err
+	}
+	log.Printf("admin: %s reset cooldown of %s %s\n", by, target, value)
+	return nil
+}
+
+// addToList 把地址、微信用户或ip加入黑名单或白名单，条目的类型按value自动识别
+func addToList(entry *store.ListEntry) error {
+	entry.Target = adminTarget(entry.Value)
+	if err := db.AddListEntry(entry); err != nil {
+		return err
+	}
+	log.Printf("admin: %s added %s %s to %slist: %s\n", entry.By, entry.Target, entry.Value, entry.List, entry.Reason)
+	return nil
+}
+
+// removeFromList 把地址、微信用户或ip移出黑名单或白名单
+func removeFromList(list, value, reason, by string) error {
+	target := adminTarget(value)
+	if err := db.RemoveListEntry(list, target, value, reason, by, time.Now()); err != nil {
+		return err
+	}
+	log.Printf("admin: %s removed %s %s from %slist: %s\n", by, target, value, list, reason)
+	return nil
+}
+
+// manualPayout 手动给地址打币，不受暂停、名单、申请限制和发放上限的限制
+func manualPayout(address, by string) (*store.ClaimRecord, error) {
+	claim, err := db.ReserveManual(address, by, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("admin: %s triggered payout %d to %s\n", by, claim.ID, claim.Address)
+	payoutWorker.Wake()
+	return claim, nil
+}
+
+// isAdmin 微信用户是否可以发送管理指令
+func isAdmin(openid string) bool {
+	for _, admin := range conf.Ops.Admins {
+		if admin == openid {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAdmin 执行管理员发送的管理指令，其他用户发送的内容按普通文本处理。
+// 明文消息的签名只包括timestamp和nonce，消息中的发送人可以伪造，只接受校验过msg_signature的加密消息
+func handleAdmin(ctx *Context) {
+	openid := ctx.Msg.FromUserName
+	admin := isAdmin(openid)
+	if admin && !ctx.encrypted {
+		log.Printf("admin: ignore plaintext admin command from %s\n", openid)
+	}
+	if !admin || !ctx.encrypted {
+		if args, ok := matchRule(strings.TrimSpace(ctx.Msg.Content)); ok {
+			ctx.Args = args
+			handleRule(ctx)
+			return
+		}
+		ctx.ReplyMessage(replies.Message("default", nil))
+		return
+	}
+	fields := strings.Fields(ctx.Args[0])
+	if len(fields) == 0 {
+		ctx.ReplyText(adminHelp())
+		return
+	}
+	cmd, args := fields[0], fields[1:]
+	arg, reason := "", ""
+	if len(args) > 0 {
+		arg, reason = args[0], strings.Join(args[1:], " ")
+	}
+	by := "wechat:" + openid
+	switch {
+	case cmd == "状态":
+		ctx.ReplyText(adminStatusText())
+	case cmd == "暂停":
+		ctx.ReplyText(adminResult(pausePayouts(true, strings.Join(args, " "), by), "已暂停打币"))
+	case cmd == "恢复":
+		ctx.ReplyText(adminResult(pausePayouts(false, "", by), "已恢复打币"))
+	case cmd == "记录" && arg != "":
+		ctx.ReplyText(adminHistoryText(arg))
+	case cmd == "重置" && arg != "":
+		ctx.ReplyText(adminResult(resetCooldown(arg, by), "已重置 "+arg+" 的申请间隔"))
+	case cmd == "拉黑" && arg != "":
+		entry := &store.ListEntry{List: store.Blacklist, Value: arg, Reason: reason, By: by, CreatedAt: time.Now()}
+		ctx.ReplyText(adminResult(addToList(entry), "已把 "+arg+" 加入黑名单"))
+	case cmd == "取消拉黑" && arg != "":
+		ctx.ReplyText(adminResult(removeFromList(store.Blacklist, arg, reason, by), "已把 "+arg+" 移出黑名单"))
+	case cmd == "白名单" && arg != "":
+		entry := adminWhitelistEntry(args[1:])
+		entry.Value, entry.By, entry.CreatedAt = arg, by, time.Now()
+		ctx.ReplyText(adminResult(addToList(entry), "已把 "+arg+" 加入白名单"))
+	case cmd == "取消白名单" && arg != "":
+		ctx.ReplyText(adminResult(removeFromList(store.Whitelist, arg, reason, by), "已把 "+arg+" 移出白名单"))
+	case cmd == "打币" && arg != "":
+		if !fromLemoAddress(arg) {
+			ctx.ReplyText("不是正确的Lemo地址: " + arg)
+			return
+		}
+		claim, err := manualPayout(arg, by)
+		if err != nil {
+			ctx.ReplyText(adminResult(err, ""))
+			return
+		}
+		ctx.ReplyText(fmt.Sprintf("已加入打币队列，申请id: %d", claim.ID))
+	default:
+		ctx.ReplyText(adminHelp())
+	}
+}
+
+// adminWhitelistEntry 解析白名单指令中地址之后的参数，第一个参数是数字时为申请间隔(秒)，是"不限"时不限制申请间隔和次数，
+// 其余的为原因。都不设置时仍使用默认的申请限制
+func adminWhitelistEntry(args []string) *store.ListEntry {
+	entry := &store.ListEntry{List: store.Whitelist}
+	if len(args) > 0 {
+		if interval, err := strconv.ParseUint(args[0], 10, 64); err == nil && interval > 0 {
+			entry.Interval, args = interval, args[1:]
+		} else if args[0] == "不限" {
+			entry.Unlimited, args = true, args[1:]
+		}
+	}
+	entry.Reason = strings.Join(args, " ")
+	return entry
+}
+
+// adminResult 管理指令的执行结果
+func adminResult(err error, ok string) string {
+	if err == store.ErrNotFound {
+		return "没有找到对应的记录"
+	}
+	if err != nil {
+		log.Println("admin command error:", err)
+		return "执行失败: " + err.Error()
+	}
+	return ok
+}
+
+func adminHelp() string {
+	return strings.Join([]string{
+		"管理指令:",
+		"#状态",
+		"#暂停 [原因]",
+		"#恢复",
+		"#记录 <地址|openid|ip>",
+		"#重置 <地址|openid|ip>",
+		"#拉黑 <地址|openid|ip> [原因]",
+		"#取消拉黑 <地址|openid|ip> [原因]",
+		"#白名单 <地址|openid|ip> [间隔秒数|不限] [原因]",
+		"#取消白名单 <地址|openid|ip> [原因]",
+		"#打币 <地址>",
+	}, "\n")
+}
+
+// formatCap 发放上限，nil表示不限制
+func formatCap(limit *big.Int) string {
+	if limit == nil {
+		return "不限"
+	}
+	return formatLemo(limit)
+}
+
+func adminStatusText() string {
+	status, err := getStatus()
+	if err != nil {
+		return adminResult(err, "")
+	}
+	lines := []string{"打币状态: 正常"}
+	if status.Pause.Paused {
+		lines[0] = fmt.Sprintf("打币状态: 已暂停(%s %s) %s", status.Pause.By, status.Pause.UpdatedAt.Format("01-02 15:04"), status.Pause.Reason)
+	}
+	balance := status.Balance
+	if balance == "" {
+		balance = "查询失败"
+	}
+	budget := status.Budget
+	lines = append(lines,
+		"打币账户: "+status.Sender,
+		"余额: "+balance,
+		fmt.Sprintf("本小时已发放: %s / %s LEMO", formatLemo(budget.HourSpent), formatCap(budget.HourlyCap)),
+		fmt.Sprintf("今天已发放: %s / %s LEMO", formatLemo(budget.DaySpent), formatCap(budget.DailyCap)),
+	)
+	return strings.Join(lines, "\n")
+}
+
+func adminHistoryText(value string) string {
+	records, err := db.ClaimHistory(adminTarget(value), value, adminHistoryLimit)
+	if err != nil {
+		return adminResult(err, "")
+	}
+	if len(records) == 0 {
+		return "没有申请记录"
+	}
+	lines := []string{fmt.Sprintf("%s 最近的申请:", value)}
+	for _, record := range records {
+		lines = append(lines, fmt.Sprintf("#%d %s %s %s %s", record.ID, record.CreatedAt.Format("01-02 15:04"), record.Channel, record.Status, record.Address))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/lemoTestCoin/autoreply"
+	"github.com/lemoTestCoin/config"
+	"github.com/lemoTestCoin/store"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAdmin = "oAdminOpenId"
+
+// setupWeChat 设置处理公众号消息需要的全局变量，使用微信文档示例中的token和密钥
+func setupWeChat(t *testing.T, mode string) *Router {
+	var err error
+	conf = &config.Config{
+		WeChat: config.WeChatConfig{Token: sampleToken, AppID: sampleAppId, EncryptMode: mode, EncodingAESKey: sampleEncodingAESKey},
+		Ops:    config.OpsConfig{Admins: []string{testAdmin}},
+	}
+	if crypter, err = newMsgCrypter(sampleToken, sampleAppId, sampleEncodingAESKey); err != nil {
+		t.Fatal(err)
+	}
+	if replies, err = autoreply.Load(""); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = store.Open(filepath.Join(t.TempDir(), "bolt.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		conf, crypter, replies, db = nil, nil, nil, nil
+	})
+	router := NewRouter()
+	registerHandlers(router)
+	return router
+}
+
+// wechatRequest 构造微信服务器推送的文本消息，encrypt为true时使用安全模式加密
+func wechatRequest(t *testing.T, from, content string, timestamp time.Time, encrypt bool) *http.Request {
+	body, err := xml.Marshal(&Message{ToUserName: "gh_faucet", FromUserName: from, CreateTime: timestamp.Unix(), MsgType: msgTypeText, Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, nonce := strconv.FormatInt(timestamp.Unix(), 10), "nonce"
+	query := url.Values{"timestamp": {ts}, "nonce": {nonce}, "signature": {makeSignature(ts, nonce)}}
+	if encrypt {
+		encrypted, err := crypter.encrypt(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body, err = xml.Marshal(&EncryptRequestBody{ToUserName: "gh_faucet", Encrypt: encrypted}); err != nil {
+			t.Fatal(err)
+		}
+		query.Set("encrypt_type", "aes")
+		query.Set("msg_signature", crypter.signature(ts, nonce, encrypted))
+	}
+	return httptest.NewRequest(http.MethodPost, "/?"+query.Encode(), strings.NewReader(string(body)))
+}
+
+// replyContent 解出回复的文本内容
+func replyContent(t *testing.T, w *httptest.ResponseRecorder) string {
+	body := w.Body.Bytes()
+	encrypted := new(EncryptRequestBody)
+	if err := xml.Unmarshal(body, encrypted); err == nil && encrypted.Encrypt != "" {
+		plain, err := crypter.decrypt(encrypted.Encrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = plain
+	}
+	msg, err := parseMessage(body)
+	if err != nil {
+		return string(body)
+	}
+	return msg.Content
+}
+
+func paused(t *testing.T) bool {
+	state, err := db.PauseState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state.Paused
+}
+
+// 明文消息的发送人可以伪造，管理员的明文管理指令按普通消息处理
+func TestForgedPlaintextAdminCommandIgnored(t *testing.T) {
+	router := setupWeChat(t, modeCompatible)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, wechatRequest(t, testAdmin, "#暂停 伪造", time.Now(), false))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if paused(t) {
+		t.Fatal("plaintext admin command paused payouts")
+	}
+	if content := replyContent(t, w); content != replies.Text("default", nil) {
+		t.Fatalf("reply = %q, want the default reply", content)
+	}
+}
+
+func TestEncryptedAdminCommand(t *testing.T) {
+	router := setupWeChat(t, modeSafe)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, wechatRequest(t, testAdmin, "#暂停 维护", time.Now(), true))
+	if !paused(t) {
+		t.Fatalf("encrypted admin command did not pause payouts, reply %q", replyContent(t, w))
+	}
+	if content := replyContent(t, w); content != "已暂停打币" {
+		t.Fatalf("reply = %q", content)
+	}
+}
+
+// 过期的timestamp即使签名正确也拒绝，避免重放
+func TestStaleSignatureRejected(t *testing.T) {
+	router := setupWeChat(t, modeSafe)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, wechatRequest(t, testAdmin, "#暂停", time.Now().Add(-time.Hour), true))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if paused(t) {
+		t.Fatal("replayed admin command paused payouts")
+	}
+}
+
+// 非管理员发送的 #… 按普通文本处理，匹配自动回复规则，没有匹配时回复默认文案
+func TestNonAdminCommandFallsBack(t *testing.T) {
+	router := setupWeChat(t, modeSafe)
+	path := filepath.Join(t.TempDir(), "replies.json")
+	rules := `{"rules": [{"name": "event", "match": "prefix", "keywords": ["#活动"], "reply": "活动规则"}]}`
+	if err := ioutil.WriteFile(path, []byte(rules), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if replies, err = autoreply.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"#活动", "活动规则"},
+		{"#暂停 维护", replies.Text("default", nil)},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, wechatRequest(t, "oUserOpenId", test.content, time.Now(), true))
+		if content := replyContent(t, w); content != test.want {
+			t.Errorf("%s: reply = %q, want %q", test.content, content, test.want)
+		}
+	}
+	if paused(t) {
+		t.Fatal("non-admin command paused payouts")
+	}
+}
+
+func TestAdminWhitelistEntry(t *testing.T) {
+	tests := []struct {
+		args []string
+		want store.ListEntry
+	}{
+		{nil, store.ListEntry{}},
+		{[]string{"3600"}, store.ListEntry{Interval: 3600}},
+		{[]string{"3600", "内部", "开发"}, store.ListEntry{Interval: 3600, Reason: "内部 开发"}},
+		{[]string{"不限", "压测"}, store.ListEntry{Unlimited: true, Reason: "压测"}},
+		{[]string{"0", "原因"}, store.ListEntry{Reason: "0 原因"}}, // 间隔为0时按原因处理
+		{[]string{"合作方"}, store.ListEntry{Reason: "合作方"}},
+	}
+	for _, test := range tests {
+		test.want.List = store.Whitelist
+		if got := adminWhitelistEntry(test.args); !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("adminWhitelistEntry(%q) = %+v, want %+v", test.args, *got, test.want)
+		}
+	}
+}
+
+func TestAdminTarget(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{testAddress, store.TargetAddress},
+		{"203.0.113.7", store.TargetIP},
+		{"2001:db8::1", store.TargetIP},
+		{"oUserOpenId", store.TargetOpenID},
+		{"203.0.113", store.TargetOpenID},
+	}
+	for _, test := range tests {
+		if got := adminTarget(test.value); got != test.want {
+			t.Errorf("adminTarget(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/lemoTestCoin/pow"
+	"github.com/lemoTestCoin/store"
+	"github.com/lemoTestCoin/types"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// http json接口，给没有微信的开发者和CI脚本申请测试币:
+//
+//	POST /api/v1/claim              {"address": "Lemo..."} 申请测试币，返回申请记录
+//	GET  /api/v1/claim/{id}         查询申请的状态
+//	GET  /api/v1/balance/{address}  查询地址的余额
+//	GET  /api/v1/challenge          获取工作量证明的题目，开启api.requirePoW时申请需要带上 nonce 和 solution
+//
+// 申请与微信使用相同的地址间隔、发放上限和打币队列，微信用户的限制换成按客户端ip限制
+const apiPrefix = "/api/v1/"
+
+// 请求体的最大长度
+const maxAPIBody = 4096
+
+// 按客户端ip限制请求http json接口和网页接口的频率
+var apiLimiter *ipLimiter
+
+// challengeLimiter 按客户端ip限制获取工作量证明题目的次数，每个题目都要写一次db
+var challengeLimiter *ipLimiter
+
+// apiError 接口返回的错误，error为错误码，message为说明
+type apiError struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	RetryAfter int64  `json:"retryAfter,omitempty"` // 需要等待的秒数
+}
+
+// claimRequest http接口和网页提交的申请，需要工作量证明时带上题目和解
+type claimRequest struct {
+	Address  string `json:"address"`
+	Nonce    string `json:"nonce"`
+	Solution string `json:"solution"`
+}
+
+// claimResponse 返回给接口的申请记录，不包括openid和ip
+type claimResponse struct {
+	ID        uint64            `json:"id"`
+	Address   string            `json:"address"`
+	Amount    string            `json:"amount"` // 单位为mo
+	Status    store.ClaimStatus `json:"status"`
+	TxHash    string            `json:"txHash,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+func newClaimResponse(record *store.ClaimRecord) *claimResponse {
+	return &claimResponse{
+		ID:        record.ID,
+		Address:   record.Address,
+		Amount:    record.Amount,
+		Status:    record.Status,
+		TxHash:    record.TxHash,
+		Error:     record.Error,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+	}
+}
+
+// writeAPIError 输出json格式的错误，需要等待时同时设置Retry-After
+func writeAPIError(w http.ResponseWriter, status int, code, message string, wait time.Duration) {
+	e := &apiError{Error: code, Message: message}
+	if wait > 0 {
+		e.RetryAfter = int64((wait + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.FormatInt(e.RetryAfter, 10))
+	}
+	writeJSON(w, status, e)
+}
+
+// writeClaimError 把Reserve返回的错误转换为接口的错误
+func writeClaimError(w http.ResponseWriter, err error) {
+	switch e := err.(type) {
+	case *store.CooldownError:
+		writeAPIError(w, http.StatusTooManyRequests, "address_cooldown", "address claimed recently, wait "+e.Wait.Round(time.Second).String(), e.Wait)
+	case *store.IPLimitError:
+		if e.QuotaSpent {
+			writeAPIError(w, http.StatusTooManyRequests, "ip_quota", "daily claim quota of this ip spent, wait "+e.Wait.Round(time.Second).String(), e.Wait)
+		} else {
+			writeAPIError(w, http.StatusTooManyRequests, "ip_cooldown", "this ip claimed recently, wait "+e.Wait.Round(time.Second).String(), e.Wait)
+		}
+	case *store.BudgetError:
+		writeAPIError(w, http.StatusServiceUnavailable, "budget_exhausted", "faucet budget exhausted until "+e.ResetAt.Format(time.RFC3339), time.Until(e.ResetAt))
+	case *store.BlacklistError:
+		writeAPIError(w, http.StatusForbidden, "blacklisted", "address or ip is blacklisted", 0)
+	default:
+		if err == store.ErrPaused {
+			writeAPIError(w, http.StatusServiceUnavailable, "paused", "faucet payouts are paused", 0)
+			return
+		}
+		log.Println("reserve claim error:", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "reserve claim failed", 0)
+	}
+}
+
+// clientIP 获取客户端ip，配置了trustProxy时使用反向代理设置的请求头
+func clientIP(r *http.Request) string {
+	if conf.API.TrustProxy {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// serveAPI 按路径分发 /api/v1/ 下的请求
+func serveAPI(w http.ResponseWriter, r *http.Request) {
+	if !apiLimiter.Allow(clientIP(r), time.Now()) {
+		writeAPIError(w, http.StatusTooManyRequests, "rate_limited", "too many requests", time.Minute)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	switch {
+	case path == "claim":
+		if checkMethod(w, r, http.MethodPost) {
+			apiClaim(w, r)
+		}
+	case strings.HasPrefix(path, "claim/"):
+		if checkMethod(w, r, http.MethodGet) {
+			apiGetClaim(w, strings.TrimPrefix(path, "claim/"))
+		}
+	case strings.HasPrefix(path, "balance/"):
+		if checkMethod(w, r, http.MethodGet) {
+			apiBalance(w, strings.TrimPrefix(path, "balance/"))
+		}
+	case path == "challenge" && conf.API.RequirePoW:
+		if checkMethod(w, r, http.MethodGet) {
+			serveChallenge(w, r)
+		}
+	default:
+		writeAPIError(w, http.StatusNotFound, "not_found", "unknown api "+r.URL.Path, 0)
+	}
+}
+
+// checkMethod 请求方法不对时返回405
+func checkMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "use "+method, 0)
+	return false
+}
+
+// readClaim 从json请求体或者表单中读取申请
+func readClaim(r *http.Request) (*claimRequest, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxAPIBody)
+	req := &claimRequest{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		req.Address, req.Nonce, req.Solution = r.PostForm.Get("address"), r.PostForm.Get("nonce"), r.PostForm.Get("solution")
+	}
+	req.Address = strings.TrimSpace(req.Address)
+	return req, nil
+}
+
+// serveChallenge 发出一个工作量证明的题目，超过每分钟的次数时返回429
+func serveChallenge(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	if !challengeLimiter.Allow(clientIP(r), now) {
+		writeAPIError(w, http.StatusTooManyRequests, "rate_limited", "too many challenges", time.Minute)
+		return
+	}
+	challenge, err := powIssuer.Issue(now)
+	if err != nil {
+		log.Println("issue pow challenge error:", err)
+		writeAPIError(w, http.StatusServiceUnavailable, "internal_error", "issue challenge failed", 0)
+		return
+	}
+	writeJSON(w, http.StatusOK, challenge)
+}
+
+// checkPoW 验证申请中的工作量证明，失败时返回403
+func checkPoW(w http.ResponseWriter, req *claimRequest) bool {
+	err := powIssuer.Redeem(req.Nonce, req.Solution, time.Now())
+	if err == nil {
+		return true
+	}
+	if err != pow.ErrUnknownChallenge && err != pow.ErrExpired && err != pow.ErrInvalidSolution {
+		log.Println("redeem pow challenge error:", err)
+	}
+	writeAPIError(w, http.StatusForbidden, "challenge_failed", err.Error(), 0)
+	return false
+}
+
+// apiClaim 申请测试币，申请加入打币队列后返回202和申请记录，之后通过 GET /api/v1/claim/{id} 查询状态
+func apiClaim(w http.ResponseWriter, r *http.Request) {
+	req, err := readClaim(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "invalid request body: "+err.Error(), 0)
+		return
+	}
+	if !fromLemoAddress(req.Address) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_address", "invalid lemo address: "+req.Address, 0)
+		return
+	}
+	if conf.API.RequirePoW && !checkPoW(w, req) {
+		return
+	}
+	claim, err := db.ReserveIP(req.Address, clientIP(r), store.ChannelAPI, time.Now())
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+	payoutWorker.Wake()
+	writeJSON(w, http.StatusAccepted, newClaimResponse(claim))
+}
+
+// apiGetClaim 查询申请的状态
+func apiGetClaim(w http.ResponseWriter, idStr string) {
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "invalid claim id: "+idStr, 0)
+		return
+	}
+	claim, err := db.GetClaim(id)
+	if err == store.ErrNotFound {
+		writeAPIError(w, http.StatusNotFound, "not_found", "claim not found", 0)
+		return
+	}
+	if err != nil {
+		log.Println("get claim error:", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "get claim failed", 0)
+		return
+	}
+	writeJSON(w, http.StatusOK, newClaimResponse(claim))
+}
+
+// apiBalance 查询地址的余额
+func apiBalance(w http.ResponseWriter, address string) {
+	if !fromLemoAddress(address) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_address", "invalid lemo address: "+address, 0)
+		return
+	}
+	balance, err := types.GetBalance(address)
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, "node_error", "get balance from chain node failed", 0)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"address": address, "balance": balance})
+}
+
+// ipLimiter 按客户端ip限制每分钟的请求次数，limit为0表示不限制
+type ipLimiter struct {
+	limit  uint64
+	mu     sync.Mutex
+	minute int64             // 当前统计的分钟
+	counts map[string]uint64 // 当前分钟内每个ip的请求次数
+}
+
+func newIPLimiter(limit uint64) *ipLimiter {
+	return &ipLimiter{limit: limit, counts: make(map[string]uint64)}
+}
+
+// Allow 记录一次请求，超过限制时返回false
+func (l *ipLimiter) Allow(ip string, now time.Time) bool {
+	if l.limit == 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if minute := now.Unix() / 60; minute != l.minute {
+		l.minute = minute
+		l.counts = make(map[string]uint64)
+	}
+	l.counts[ip]++
+	return l.counts[ip] <= l.limit
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 微信公众号消息加解密方式
+const (
+	modePlaintext  = "plaintext"  // 明文模式
+	modeCompatible = "compatible" // 兼容模式，明文和密文的请求都接受，按请求的方式回复
+	modeSafe       = "safe"       // 安全模式，只接受密文的请求
+)
+
+var (
+	errInvalidMsgSignature = errors.New("invalid msg_signature")
+	errInvalidAppId        = errors.New("decrypted appid does not match")
+	errPlaintextRejected   = errors.New("plaintext message is not allowed in safe mode")
+)
+
+// 加密消息的请求
+type EncryptRequestBody struct {
+	XMLName    xml.Name `xml:"xml"`
+	ToUserName string
+	Encrypt    string
+}
+
+// 加密消息的响应
+type EncryptResponseBody struct {
+	XMLName      xml.Name `xml:"xml"`
+	Encrypt      CDATAText
+	MsgSignature CDATAText
+	TimeStamp    string
+	Nonce        CDATAText
+}
+
+// msgCrypter 微信消息的AES-CBC加解密
+type msgCrypter struct {
+	token string
+	appId string
+	key   []byte // 由EncodingAESKey解码得到的32字节密钥，iv为key的前16字节
+}
+
+// newMsgCrypter encodingAESKey为公众号后台配置的43位字符
+func newMsgCrypter(token, appId, encodingAESKey string) (*msgCrypter, error) {
+	if len(encodingAESKey) != 43 {
+		return nil, fmt.Errorf("invalid EncodingAESKey length %d, need 43", len(encodingAESKey))
+	}
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return nil, fmt.Errorf("invalid EncodingAESKey: %v", err)
+	}
+	return &msgCrypter{token: token, appId: appId, key: key}, nil
+}
+
+// signature msg_signature = sha1(sort(token, timestamp, nonce, encrypt))
+func (c *msgCrypter) signature(timestamp, nonce, encrypt string) string {
+	s1 := []string{c.token, timestamp, nonce, encrypt}
+	sort.Strings(s1)
+	s := sha1.New()
+	io.WriteString(s, strings.Join(s1, ""))
+	return fmt.Sprintf("%x", s.Sum(nil))
+}
+
+// encrypt 明文格式为 random(16字节) + msg长度(4字节网络序) + msg + appid，PKCS#7补位后AES-CBC加密再base64
+func (c *msgCrypter) encrypt(msg []byte) (string, error) {
+	buf := make([]byte, 20, 20+len(msg)+len(c.appId))
+	if _, err := io.ReadFull(rand.Reader, buf[:16]); err != nil {
+		return "", err
+	}
+	binary.BigEndian.PutUint32(buf[16:20], uint32(len(msg)))
+	buf = append(buf, msg...)
+	buf = append(buf, c.appId...)
+	buf = pkcs7Pad(buf, 32)
+
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return "", err
+	}
+	cipherText := make([]byte, len(buf))
+	cipher.NewCBCEncrypter(block, c.key[:16]).CryptBlocks(cipherText, buf)
+	return base64.StdEncoding.EncodeToString(cipherText), nil
+}
+
+// decrypt 解密并校验appid，返回消息明文
+func (c *msgCrypter) decrypt(encrypt string) ([]byte, error) {
+	cipherText, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil {
+		return nil, err
+	}
+	if len(cipherText) == 0 || len(cipherText)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted message length")
+	}
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(cipherText))
+	cipher.NewCBCDecrypter(block, c.key[:16]).CryptBlocks(plain, cipherText)
+	if plain, err = pkcs7Unpad(plain, 32); err != nil {
+		return nil, err
+	}
+	if len(plain) < 20 {
+		return nil, errors.New("invalid decrypted message")
+	}
+	msgLen := int(binary.BigEndian.Uint32(plain[16:20]))
+	if 20+msgLen > len(plain) {
+		return nil, errors.New("invalid decrypted message length")
+	}
+	if string(plain[20+msgLen:]) != c.appId {
+		return nil, errInvalidAppId
+	}
+	return plain[20 : 20+msgLen], nil
+}
+
+// pkcs7Pad 微信使用32字节为块大小补位
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	pad := blockSize - len(data)%blockSize
+	return append(data, bytes.Repeat([]byte{byte(pad)}, pad)...)
+}
+
+func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("invalid padding")
+	}
+	pad := int(data[len(data)-1])
+	if pad < 1 || pad > blockSize || pad > len(data) {
+		return nil, errors.New("invalid padding")
+	}
+	// 补位的每个字节都必须等于补位的长度
+	if !bytes.Equal(data[len(data)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errors.New("invalid padding")
+	}
+	return data[:len(data)-pad], nil
+}
+
+// decryptRequest 根据加解密方式处理请求的body，返回明文的body以及请求是否为密文
+func decryptRequest(r *http.Request, body []byte) ([]byte, bool, error) {
+	encrypted := r.Form.Get("encrypt_type") == "aes"
+	if crypter == nil || conf.WeChat.EncryptMode == modePlaintext {
+		return body, false, nil
+	}
+	if !encrypted {
+		if conf.WeChat.EncryptMode == modeSafe {
+			return nil, false, errPlaintextRejected
+		}
+		return body, false, nil
+	}
+	requestBody := &EncryptRequestBody{}
+	if err := xml.Unmarshal(body, requestBody); err != nil {
+		return nil, true, err
+	}
+	if crypter.signature(r.Form.Get("timestamp"), r.Form.Get("nonce"), requestBody.Encrypt) != r.Form.Get("msg_signature") {
+		return nil, true, errInvalidMsgSignature
+	}
+	plain, err := crypter.decrypt(requestBody.Encrypt)
+	return plain, true, err
+}
+
+// encryptResponse 加密回复给微信的xml
+func encryptResponse(reply []byte) ([]byte, error) {
+	encrypt, err := crypter.encrypt(reply)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := strconv.FormatInt(time.Now().UnixNano()%1e10, 10)
+	return xml.MarshalIndent(&EncryptResponseBody{
+		Encrypt:      value2CDATA(encrypt),
+		MsgSignature: value2CDATA(crypter.signature(timestamp, nonce, encrypt)),
+		TimeStamp:    timestamp,
+		Nonce:        value2CDATA(nonce),
+	}, " ", "  ")
+}
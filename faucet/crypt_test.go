@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 微信消息加解密文档中的示例参数和消息。sampleEncrypt由openssl按文档的格式独立生成，
+// 随机串为 aaaabbbbccccdddd，sampleSignature为 sha1(sort(token, timestamp, nonce, encrypt))
+const (
+	sampleToken          = "pamtest"
+	sampleAppId          = "wxb11529c136998cb6"
+	sampleEncodingAESKey = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+	sampleTimestamp      = "1409304348"
+	sampleNonce          = "xxxxxx"
+	sampleMsg            = "<xml><ToUserName><![CDATA[oia2Tj我是中文jewbmiOUlr6X-1crbLOvLw]]></ToUserName><FromUserName><![CDATA[gh_7f083739789a]]></FromUserName><CreateTime>1407743423</CreateTime><MsgType><![CDATA[video]]></MsgType><Video><MediaId><![CDATA[eYJ1MbwPRJtOvIEabaxHs7TX2D-HV71s79GUxqdUkjm6Gs2Ed1KF3ulAOA9H1xG0]]></MediaId><Title><![CDATA[testCallBackReplyVideo]]></Title><Description><![CDATA[testCallBackReplyVideo]]></Description></Video></xml>"
+	sampleEncrypt        = "jn1L23DB+6ELqJ+6bruv23M2GmYfkv0xBh2h+XTBOKVKcgDFHle6gqcZ1cZrk3e1qjPQ1F4RsLWzQRG9udbKWesxlkupqcEcW7ZQweImX9+wLMa0GaUzpkycA8+IamDBxn5loLgZpnS7fVAbExOkK5DYHBmv5tptA9tklE/fTIILHR8HLXa5nQvFb3tYPKAlHF3rtTeayNf0QuM+UW/wM9enGIDIJHF7CLHiDNAYxr+r+OrJCmPQyTy8cVWlu9iSvOHPT/77bZqJucQHQ04sq7KZI27OcqpQNSto2OdHCoTccjggX5Z9Mma0nMJBU+jLKJ38YB1fBIz+vBzsYjrTmFQ44YfeEuZ+xRTQwr92vhA9OxchWVINGC50qE/6lmkwWTwGX9wtQpsJKhP+oS7rvTY8+VdzETdfakjkwQ5/Xka042OlUb1/slTwo4RscuQ+RdxSGvDahxAJ6+EAjLt9d8igHngxIbf6YyqqROxuxqIeIch3CssH/LqRs+iAcILvApYZckqmA7FNERspKA5f8GoJ9sv8xmGvZ9Yrf57cExWtnX8aCMMaBropU/1k+hKP5LVdzbWCG0hGwx/dQudYR/eXp3P0XxjlFiy+9DMlaFExWUZQDajPkdPrEeOwofJb"
+	sampleSignature      = "ea88b765074e41eb8c7a75b449db34fa2fd560d5"
+)
+
+func newSampleCrypter(t *testing.T) *msgCrypter {
+	c, err := newMsgCrypter(sampleToken, sampleAppId, sampleEncodingAESKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestDecryptSample(t *testing.T) {
+	c := newSampleCrypter(t)
+	if sig := c.signature(sampleTimestamp, sampleNonce, sampleEncrypt); sig != sampleSignature {
+		t.Fatalf("signature = %s, want %s", sig, sampleSignature)
+	}
+	msg, err := c.decrypt(sampleEncrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != sampleMsg {
+		t.Fatalf("decrypted message = %q", msg)
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	c := newSampleCrypter(t)
+	encrypt, err := c.encrypt([]byte(sampleMsg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := c.decrypt(encrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != sampleMsg {
+		t.Fatalf("decrypted message = %q", msg)
+	}
+
+	other, err := newMsgCrypter(sampleToken, "wx0000000000000000", sampleEncodingAESKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.decrypt(encrypt); err != errInvalidAppId {
+		t.Fatalf("decrypt with another appid returned %v, want %v", err, errInvalidAppId)
+	}
+}
+
+func TestPKCS7Unpad(t *testing.T) {
+	data := []byte("hello")
+	padded := pkcs7Pad(append([]byte(nil), data...), 32)
+	unpadded, err := pkcs7Unpad(padded, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unpadded, data) {
+		t.Fatalf("unpad = %q, want %q", unpadded, data)
+	}
+
+	invalid := [][]byte{
+		nil,
+		append(bytes.Repeat([]byte{'a'}, 31), 0),
+		append(bytes.Repeat([]byte{'a'}, 31), 33),
+		append(bytes.Repeat([]byte{'a'}, 29), 2, 3, 3), // 只有最后一个字节正确
+	}
+	for _, data := range invalid {
+		if _, err := pkcs7Unpad(data, 32); err == nil {
+			t.Errorf("pkcs7Unpad(%v) should fail", data)
+		}
+	}
+}
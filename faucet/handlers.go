@@ -0,0 +1,219 @@
+package main
+
+import (
+	"github.com/lemoTestCoin/autoreply"
+	"github.com/lemoTestCoin/common/crypto"
+	"github.com/lemoTestCoin/store"
+	"github.com/lemoTestCoin/types"
+	"log"
+	"strings"
+	"time"
+)
+
+// registerHandlers 注册公众号消息的处理函数，新的指令在这里注册即可
+func registerHandlers(router *Router) {
+	router.Use(recoverPanic, logRequest, checkSignature)
+
+	router.HandleEvent(eventSubscribe, handleSubscribe)
+	router.HandleEvent(eventScan, handleScan)
+	router.HandleEvent(eventClick, handleClick)
+	router.HandleEvent(eventTemplateFinish, handleTemplateFinish)
+	router.Handle(msgTypeEvent, handleEvent)
+
+	router.Text(LemoAddress(), handleClaim)
+	router.Text(Prefix(getBalanceFlag), handleBalance)
+	router.Text(Prefix(adminPrefix), handleAdmin)
+	router.Text(Exact("申请测试账户"), handleNewAccount)
+	// 用户在公众号输入'测试币','水龙头','LemoChain','官网','交易','周报'等关键词的回复，在规则文件中配置
+	router.Text(matchRule, handleRule)
+	router.Handle(msgTypeText, messageReply("default"))
+
+	// 如果用户发送的消息是图片、视频、音频等类型，则不处理，以后有需求直接注册对应类型的处理函数即可
+	router.Fallback(messageReply("default"))
+}
+
+// messageReply 回复规则文件中名为name的固定回复
+func messageReply(name string) HandlerFunc {
+	return func(ctx *Context) {
+		ctx.ReplyMessage(replies.Message(name, nil))
+	}
+}
+
+// matchRule 匹配规则文件中的关键词回复规则
+func matchRule(content string) ([]string, bool) {
+	rule, args := replies.Match(content, time.Now())
+	return args, rule != nil
+}
+
+// handleRule 按匹配到的规则回复
+func handleRule(ctx *Context) {
+	reply, err := replies.Reply(ctx.Args[0], time.Now(), autoreply.Vars{"OpenID": ctx.Msg.FromUserName})
+	if err != nil {
+		log.Println("render auto reply error:", err)
+		ctx.ReplyMessage(replies.Message("default", nil))
+		return
+	}
+	ctx.ReplyMessage(reply)
+}
+
+// 未关注的用户扫带参数的二维码关注时，EventKey为 qrscene_ 加上场景值
+const qrScenePrefix = "qrscene_"
+
+// recordScene 记录用户扫码的二维码场景值，用于统计推广渠道带来的用户和申请，并按场景值给用户打标签
+func recordScene(ctx *Context) {
+	scene := strings.TrimPrefix(ctx.Msg.EventKey, qrScenePrefix)
+	if scene == "" {
+		return
+	}
+	if err := db.RecordScene(ctx.Msg.FromUserName, scene, time.Now()); err != nil {
+		log.Println("record qrcode scene error:", err)
+	}
+	tagWorker.Scanned(ctx.Msg.FromUserName, scene)
+}
+
+// handleSubscribe 用户关注公众号
+func handleSubscribe(ctx *Context) {
+	recordScene(ctx)
+	// EventKey为空说明是微信公众号自带的二维码，只是用户扫此二维码关注公众号的操作
+	if ctx.Msg.EventKey == "" {
+		ctx.ReplyMessage(replies.Message("welcome", nil))
+		return
+	}
+	// 新用户扫水龙头推广的二维码关注
+	ctx.ReplyMessage(replies.Message("subscribe", nil))
+}
+
+// handleScan 已关注的用户扫码进公众号
+func handleScan(ctx *Context) {
+	recordScene(ctx)
+	if ctx.Msg.EventKey == "" {
+		ctx.ReplyMessage(replies.Message("welcome", nil))
+		return
+	}
+	ctx.ReplyMessage(replies.Message("scan", nil))
+}
+
+// 自定义菜单中click按钮的key，菜单定义见config/menu.example.json
+const (
+	menuKeyClaim      = "FAUCET_CLAIM"
+	menuKeyBalance    = "FAUCET_BALANCE"
+	menuKeyNewAccount = "FAUCET_NEW_ACCOUNT"
+)
+
+// handleClick 用户点击自定义菜单的click按钮
+func handleClick(ctx *Context) {
+	switch ctx.Msg.EventKey {
+	case menuKeyClaim:
+		// 用户申请过时，直接给上次申请的地址申请，否则提示用户发送地址
+		address := lastClaimAddress(ctx.Msg.FromUserName)
+		if address == "" {
+			ctx.ReplyMessage(replies.Message("claimPrompt", nil))
+			return
+		}
+		ctx.Args = []string{address}
+		handleClaim(ctx)
+	case menuKeyBalance:
+		address := lastClaimAddress(ctx.Msg.FromUserName)
+		if address == "" {
+			ctx.ReplyMessage(replies.Message("balancePrompt", nil))
+			return
+		}
+		ctx.Args = []string{address}
+		handleBalance(ctx)
+	case menuKeyNewAccount:
+		handleNewAccount(ctx)
+	default:
+		// 其他按钮的key按规则文件中的关键词回复
+		if rule, _ := replies.Match(ctx.Msg.EventKey, time.Now()); rule != nil {
+			ctx.Args = []string{ctx.Msg.EventKey}
+			handleRule(ctx)
+			return
+		}
+		handleEvent(ctx)
+	}
+}
+
+// lastClaimAddress 返回微信用户上次申请测试币的地址，没有申请过返回空
+func lastClaimAddress(openid string) string {
+	user, err := db.GetUser(openid)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Println("get user error:", err)
+		}
+		return ""
+	}
+	claim, err := db.GetClaim(user.LastClaimID)
+	if err != nil {
+		log.Println("get claim error:", err)
+		return ""
+	}
+	return claim.Address
+}
+
+// handleEvent 没有单独注册处理函数的事件
+func handleEvent(ctx *Context) {
+	if ctx.Msg.EventKey == "" {
+		ctx.ReplyMessage(replies.Message("welcome", nil))
+		return
+	}
+	ctx.ReplyMessage(replies.Message("event", nil)) // 防止给微信的响应为nil从而报错
+}
+
+// handleClaim 用户发送Lemo地址申请测试币
+func handleClaim(ctx *Context) {
+	address := ctx.Args[0]
+	// 满足打币的条件: 距离地址上次申请超过申请间隔，微信用户没有超过申请间隔和每天的申请次数，且没有超过发放上限，
+	// 检查和记录在同一个db事务中完成，避免并发申请重复打币
+	claim, err := db.Reserve(address, ctx.Msg.FromUserName, time.Now())
+	if cooldown, ok := err.(*store.CooldownError); ok { // 不满足打币时间
+		// 回复用户消息，为距离上次申请时间间隔小于申请间隔，白名单中的地址使用条目的申请间隔
+		ctx.ReplyMessage(replies.Message("addressCooldown", autoreply.Vars{"Interval": formatInterval(cooldown.Interval), "Wait": formatWait(cooldown.Wait)}))
+	} else if limit, ok := err.(*store.UserLimitError); ok { // 微信用户申请超过限制
+		if limit.QuotaSpent {
+			ctx.ReplyMessage(replies.Message("userQuota", autoreply.Vars{"Quota": conf.Faucet.UserDailyQuota, "Wait": formatWait(limit.Wait)}))
+		} else {
+			ctx.ReplyMessage(replies.Message("userCooldown", autoreply.Vars{"Interval": formatInterval(limit.Interval), "Wait": formatWait(limit.Wait)}))
+		}
+	} else if budget, ok := err.(*store.BudgetError); ok { // 测试币发放达到上限
+		ctx.ReplyMessage(replies.Message("budgetExhausted", autoreply.Vars{"ResetAt": formatResetAt(budget.ResetAt)}))
+	} else if err == store.ErrPaused { // 运维暂停了打币
+		ctx.ReplyMessage(replies.Message("faucetPaused", nil))
+	} else if _, ok := err.(*store.BlacklistError); ok { // 地址或者微信用户在黑名单中
+		ctx.ReplyMessage(replies.Message("blacklisted", nil))
+	} else if err != nil {
+		log.Println("reserve claim error:", err)
+		ctx.ReplyMessage(replies.Message("claimFailed", nil))
+	} else {
+		// 申请已经加入打币队列，由后台的payoutWorker发送交易，交易结果通过客服消息通知用户
+		payoutWorker.Wake()
+		ctx.ReplyMessage(replies.Message("claimAccepted", autoreply.Vars{"Address": claim.Address, "Amount": formatClaimAmount(claim)}))
+	}
+}
+
+// handleBalance 查询账户余额，用户发送 余额+Lemo地址
+func handleBalance(ctx *Context) {
+	lemoAdd := ctx.Args[0]
+	// 验证地址为正确的lemo地址
+	if !fromLemoAddress(lemoAdd) {
+		ctx.ReplyMessage(replies.Message("invalidAddress", autoreply.Vars{"Address": lemoAdd}))
+		return
+	}
+	balance, err := types.GetBalance(lemoAdd)
+	if err != nil {
+		log.Println("get balance error:", err)
+		ctx.ReplyMessage(replies.Message("balanceFailed", autoreply.Vars{"Address": lemoAdd}))
+		return
+	}
+	ctx.ReplyMessage(replies.Message("balance", autoreply.Vars{"Address": lemoAdd, "Balance": balance}))
+}
+
+// handleNewAccount 生成一个测试账户发给用户
+func handleNewAccount(ctx *Context) {
+	accountKey, err := crypto.GenerateAddress()
+	if err != nil {
+		log.Println("generate address error:", err)
+		ctx.ReplyMessage(replies.Message("default", nil))
+		return
+	}
+	ctx.ReplyMessage(replies.Message("newAccount", autoreply.Vars{"Private": accountKey.Private, "Address": accountKey.Address}))
+}
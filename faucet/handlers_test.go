@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/lemoTestCoin/autoreply"
+	"github.com/lemoTestCoin/store"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testAddress = "Lemo83W7HDZYS33Z745NZ2FGF37565DSF5AHJZ4J"
+
+// 白名单中的地址按条目的申请间隔回复，而不是默认的申请间隔
+func TestClaimCooldownUsesWhitelistInterval(t *testing.T) {
+	router := setupWeChat(t, modeSafe)
+	db.SetPolicy(store.Policy{Amount: "10", AddressInterval: 24 * time.Hour})
+	entry := &store.ListEntry{List: store.Whitelist, Target: store.TargetAddress, Value: testAddress, Interval: 600, CreatedAt: time.Now()}
+	if err := db.AddListEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Reserve(testAddress, "user", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, wechatRequest(t, "user", testAddress, time.Now(), true))
+	want := replies.Text("addressCooldown", autoreply.Vars{"Interval": "10分钟", "Wait": formatWait(10 * time.Minute)})
+	if content := replyContent(t, w); content != want {
+		t.Fatalf("reply = %q, want %q", content, want)
+	}
+}
+
+// 未知的错误也要回复用户
+func TestClaimErrorReplies(t *testing.T) {
+	router := setupWeChat(t, modeSafe)
+	db.SetPolicy(store.Policy{Amount: "10"})
+	db.Close()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, wechatRequest(t, "user", testAddress, time.Now(), true))
+	if content := replyContent(t, w); content != replies.Text("claimFailed", nil) {
+		t.Fatalf("reply = %q, want the claim failed reply", content)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/lemoTestCoin/autoreply"
+	"strings"
+	"time"
+)
+
+// 微信推送的消息类型
+const (
+	msgTypeText     = "text"
+	msgTypeImage    = "image"
+	msgTypeVoice    = "voice"
+	msgTypeVideo    = "video"
+	msgTypeLocation = "location"
+	msgTypeLink     = "link"
+	msgTypeEvent    = "event"
+)
+
+// 微信推送的事件类型
+const (
+	eventSubscribe   = "subscribe"
+	eventUnsubscribe = "unsubscribe"
+	eventScan        = "SCAN"
+	eventClick       = "CLICK"
+	eventView        = "VIEW"
+	eventLocation    = "LOCATION"
+
+	eventTemplateFinish = "TEMPLATESENDJOBFINISH"
+)
+
+// Message 微信推送过来的消息，包含所有消息类型和事件的字段，不同类型的消息只会填充其中的一部分
+type Message struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   string
+	FromUserName string
+	CreateTime   int64
+	MsgType      string
+	MsgId        int64
+
+	// 文本消息
+	Content string
+
+	// 图片、语音、视频消息
+	PicUrl       string
+	MediaId      string
+	Format       string
+	Recognition  string
+	ThumbMediaId string
+
+	// 地理位置消息
+	LocationX float64 `xml:"Location_X"`
+	LocationY float64 `xml:"Location_Y"`
+	Scale     int
+	Label     string
+
+	// 链接消息
+	Title       string
+	Description string
+	Url         string
+
+	// 事件推送
+	Event     string
+	EventKey  string
+	Ticket    string
+	Latitude  float64
+	Longitude float64
+	Precision float64
+
+	// 模板消息发送结果的推送，注意消息id的字段名为MsgID
+	MsgID  int64
+	Status string
+}
+
+// 响应用户的消息
+type TextResponseBody struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   CDATAText
+	FromUserName CDATAText
+	CreateTime   time.Duration
+	MsgType      CDATAText
+	Content      CDATAText
+}
+
+// 图文回复
+type NewsResponseBody struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   CDATAText
+	FromUserName CDATAText
+	CreateTime   time.Duration
+	MsgType      CDATAText
+	ArticleCount int
+	Articles     []ArticleItem `xml:"Articles>item"`
+}
+
+// 图文回复中的一篇文章
+type ArticleItem struct {
+	Title       CDATAText
+	Description CDATAText
+	PicUrl      CDATAText
+	Url         CDATAText
+}
+
+// 图片回复
+type ImageResponseBody struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   CDATAText
+	FromUserName CDATAText
+	CreateTime   time.Duration
+	MsgType      CDATAText
+	Image        MediaItem
+}
+
+// 语音回复
+type VoiceResponseBody struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   CDATAText
+	FromUserName CDATAText
+	CreateTime   time.Duration
+	MsgType      CDATAText
+	Voice        MediaItem
+}
+
+// 图片、语音回复的素材
+type MediaItem struct {
+	MediaId CDATAText
+}
+
+// 音乐回复
+type MusicResponseBody struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   CDATAText
+	FromUserName CDATAText
+	CreateTime   time.Duration
+	MsgType      CDATAText
+	Music        MusicItem
+}
+
+// 音乐回复的内容
+type MusicItem struct {
+	Title        CDATAText
+	Description  CDATAText
+	MusicUrl     CDATAText
+	HQMusicUrl   CDATAText
+	ThumbMediaId CDATAText
+}
+
+// CDATAText
+type CDATAText struct {
+	Text string `xml:",innerxml"`
+}
+
+// parseMessage 解析微信推送的消息
+func parseMessage(body []byte) (*Message, error) {
+	msg := &Message{}
+	if err := xml.Unmarshal(body, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// value2CDATA 内容中的 ]]> 会提前结束CDATA，需要拆成两段CDATA
+func value2CDATA(v string) CDATAText {
+	return CDATAText{"<![CDATA[" + strings.Replace(v, "]]>", "]]]]><![CDATA[>", -1) + "]]>"}
+}
+
+// 生成server响应的xml
+func makeTextResponseBody(fromUserName, toUserName, content string) ([]byte, error) {
+	textResponseBody := &TextResponseBody{}
+	textResponseBody.FromUserName = value2CDATA(fromUserName)
+	textResponseBody.ToUserName = value2CDATA(toUserName)
+	textResponseBody.MsgType = value2CDATA("text")
+	textResponseBody.Content = value2CDATA(content)
+	textResponseBody.CreateTime = time.Duration(time.Now().Unix())
+	return xml.MarshalIndent(textResponseBody, " ", "  ")
+}
+
+// makeNewsResponseBody 生成图文回复的xml
+func makeNewsResponseBody(fromUserName, toUserName string, articles []*autoreply.Article) ([]byte, error) {
+	newsResponseBody := &NewsResponseBody{}
+	newsResponseBody.FromUserName = value2CDATA(fromUserName)
+	newsResponseBody.ToUserName = value2CDATA(toUserName)
+	newsResponseBody.MsgType = value2CDATA("news")
+	newsResponseBody.CreateTime = time.Duration(time.Now().Unix())
+	for _, article := range articles {
+		newsResponseBody.Articles = append(newsResponseBody.Articles, ArticleItem{
+			Title:       value2CDATA(article.Title),
+			Description: value2CDATA(article.Description),
+			PicUrl:      value2CDATA(article.PicUrl),
+			Url:         value2CDATA(article.Url),
+		})
+	}
+	newsResponseBody.ArticleCount = len(newsResponseBody.Articles)
+	return xml.MarshalIndent(newsResponseBody, " ", "  ")
+}
+
+// makeImageResponseBody 生成图片回复的xml
+func makeImageResponseBody(fromUserName, toUserName, mediaId string) ([]byte, error) {
+	imageResponseBody := &ImageResponseBody{}
+	imageResponseBody.FromUserName = value2CDATA(fromUserName)
+	imageResponseBody.ToUserName = value2CDATA(toUserName)
+	imageResponseBody.MsgType = value2CDATA("image")
+	imageResponseBody.Image.MediaId = value2CDATA(mediaId)
+	imageResponseBody.CreateTime = time.Duration(time.Now().Unix())
+	return xml.MarshalIndent(imageResponseBody, " ", "  ")
+}
+
+// makeVoiceResponseBody 生成语音回复的xml
+func makeVoiceResponseBody(fromUserName, toUserName, mediaId string) ([]byte, error) {
+	voiceResponseBody := &VoiceResponseBody{}
+	voiceResponseBody.FromUserName = value2CDATA(fromUserName)
+	voiceResponseBody.ToUserName = value2CDATA(toUserName)
+	voiceResponseBody.MsgType = value2CDATA("voice")
+	voiceResponseBody.Voice.MediaId = value2CDATA(mediaId)
+	voiceResponseBody.CreateTime = time.Duration(time.Now().Unix())
+	return xml.MarshalIndent(voiceResponseBody, " ", "  ")
+}
+
+// makeMusicResponseBody 生成音乐回复的xml
+func makeMusicResponseBody(fromUserName, toUserName string, music *autoreply.Music) ([]byte, error) {
+	musicResponseBody := &MusicResponseBody{}
+	musicResponseBody.FromUserName = value2CDATA(fromUserName)
+	musicResponseBody.ToUserName = value2CDATA(toUserName)
+	musicResponseBody.MsgType = value2CDATA("music")
+	musicResponseBody.Music = MusicItem{
+		Title:        value2CDATA(music.Title),
+		Description:  value2CDATA(music.Description),
+		MusicUrl:     value2CDATA(music.MusicUrl),
+		HQMusicUrl:   value2CDATA(music.HQMusicUrl),
+		ThumbMediaId: value2CDATA(music.ThumbMediaId),
+	}
+	musicResponseBody.CreateTime = time.Duration(time.Now().Unix())
+	return xml.MarshalIndent(musicResponseBody, " ", "  ")
+}
+
+// makeResponseBody 按回复的类型生成xml
+func makeResponseBody(fromUserName, toUserName string, reply *autoreply.Reply) ([]byte, error) {
+	switch reply.Type {
+	case autoreply.TypeNews:
+		return makeNewsResponseBody(fromUserName, toUserName, reply.Articles)
+	case autoreply.TypeImage:
+		return makeImageResponseBody(fromUserName, toUserName, reply.MediaId)
+	case autoreply.TypeVoice:
+		return makeVoiceResponseBody(fromUserName, toUserName, reply.MediaId)
+	case autoreply.TypeMusic:
+		return makeMusicResponseBody(fromUserName, toUserName, reply.Music)
+	default:
+		return makeTextResponseBody(fromUserName, toUserName, reply.Content)
+	}
+}
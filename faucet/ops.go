@@ -0,0 +1,351 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/lemoTestCoin/store"
+	"github.com/lemoTestCoin/types"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 运维接口，需要在请求头 Authorization: Bearer <ops.token> 中带上配置的token。
+// 管理接口的参数通过query或者表单传递，target可以是Lemo地址、微信用户的openid或者ip:
+//
+//	GET    /ops/status                               打币状态、打币账户余额和发放额度
+//	POST   /ops/pause         reason                 暂停打币
+//	POST   /ops/resume                               恢复打币
+//	GET    /ops/claims        target, limit          最近的申请记录
+//	POST   /ops/cooldown      target                 重置申请间隔
+//	GET    /ops/lists         list                   black或white名单中的条目
+//	POST   /ops/lists         list, target, reason   加入名单，白名单还可以设置amount(mo)、interval(秒)或unlimited=true，ttl为有效期(秒)
+//	DELETE /ops/lists         list, target, reason   移出名单
+//	GET    /ops/lists/audit   limit                  名单的修改记录
+//	GET    /ops/lists/export                         导出名单为csv
+//	POST   /ops/lists/import                         导入请求体中的csv名单
+//	POST   /ops/payout        address                手动打币
+
+// 运维接口查询申请记录的默认条数和最大条数
+const (
+	opsHistoryLimit    = 20
+	opsHistoryMaxLimit = 200
+)
+
+// 导入名单的csv的最大长度
+const maxListCSV = 4 << 20
+
+// opsAuth 校验运维接口的token，必须使用 Bearer 方式，未配置token时运维接口不可用
+func opsAuth(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if conf.Ops.Token == "" || !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(conf.Ops.Token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// writeJSON 输出json格式的响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("write json response error:", err)
+	}
+}
+
+// opsBudget 查看当前小时和当天已经发放的测试币和上限
+func opsBudget(w http.ResponseWriter, r *http.Request) {
+	usage, err := db.BudgetUsage(time.Now())
+	if err != nil {
+		log.Println("get budget usage error:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// opsNodes 查看链节点的健康状态和错误计数
+func opsNodes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, types.GetNodeStats())
+}
+
+// opsScenes 按推广渠道(二维码场景值)统计带来的用户和申请
+func opsScenes(w http.ResponseWriter, r *http.Request) {
+	stats, err := db.SceneStats()
+	if err != nil {
+		log.Println("get scene stats error:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// opsPoW 查看工作量证明当前的难度和最近的申请量
+func opsPoW(w http.ResponseWriter, r *http.Request) {
+	if powIssuer == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": false})
+		return
+	}
+	difficulty, claims := powIssuer.Difficulty(time.Now())
+	writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": true, "difficulty": difficulty, "recentClaims": claims})
+}
+
+// opsMethod 请求方法不对时返回405
+func opsMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// opsOperator 运维接口的操作人，记录在日志和申请记录中
+func opsOperator(r *http.Request) string {
+	return "ops:" + clientIP(r)
+}
+
+// opsError 把运维操作的错误转换为http错误
+func opsError(w http.ResponseWriter, err error) {
+	if err == store.ErrNotFound {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	log.Println("ops error:", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// opsLimit 读取查询的条数，默认opsHistoryLimit条
+func opsLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.FormValue("limit")
+	if v == "" {
+		return opsHistoryLimit, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > opsHistoryMaxLimit {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// opsStatus 查看打币状态、打币账户余额和当前的发放额度
+func opsStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := getStatus()
+	if err != nil {
+		opsError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// opsPause 暂停打币
+func opsPause(w http.ResponseWriter, r *http.Request) {
+	if !opsMethod(w, r, http.MethodPost) {
+		return
+	}
+	if err := pausePayouts(true, r.FormValue("reason"), opsOperator(r)); err != nil {
+		opsError(w, err)
+		return
+	}
+	opsStatus(w, r)
+}
+
+// opsResume 恢复打币
+func opsResume(w http.ResponseWriter, r *http.Request) {
+	if !opsMethod(w, r, http.MethodPost) {
+		return
+	}
+	if err := pausePayouts(false, "", opsOperator(r)); err != nil {
+		opsError(w, err)
+		return
+	}
+	opsStatus(w, r)
+}
+
+// opsClaims 查询地址、微信用户或ip最近的申请记录
+func opsClaims(w http.ResponseWriter, r *http.Request) {
+	target := strings.TrimSpace(r.FormValue("target"))
+	if target == "" {
+		http.Error(w, "missing target", http.StatusBadRequest)
+		return
+	}
+	limit, ok := opsLimit(w, r)
+	if !ok {
+		return
+	}
+	records, err := db.ClaimHistory(adminTarget(target), target, limit)
+	if err != nil {
+		opsError(w, err)
+		return
+	}
+	if records == nil {
+		records = []*store.ClaimRecord{}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// opsCooldown 重置地址、微信用户或ip的申请间隔
+func opsCooldown(w http.ResponseWriter, r *http.Request) {
+	if !opsMethod(w, r, http.MethodPost) {
+		return
+	}
+	target := strings.TrimSpace(r.FormValue("target"))
+	if target == "" {
+		http.Error(w, "missing target", http.StatusBadRequest)
+		return
+	}
+	if err := resetCooldown(target, opsOperator(r)); err != nil {
+		opsError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// opsLists 查看、加入或者移出黑名单和白名单
+func opsLists(w http.ResponseWriter, r *http.Request) {
+	list := r.FormValue("list")
+	if list != store.Blacklist && list != store.Whitelist {
+		http.Error(w, "list must be black or white", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodGet {
+		entries, err := db.ListEntries(list)
+		if err != nil {
+			opsError(w, err)
+			return
+		}
+		if entries == nil {
+			entries = []*store.ListEntry{}
+		}
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	target := strings.TrimSpace(r.FormValue("target"))
+	if target == "" {
+		http.Error(w, "missing target", http.StatusBadRequest)
+		return
+	}
+	var err error
+	if r.Method == http.MethodDelete {
+		err = removeFromList(list, target, r.FormValue("reason"), opsOperator(r))
+	} else {
+		var entry *store.ListEntry
+		if entry, err = opsListEntry(r, list, target); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = addToList(entry)
+	}
+	if err != nil {
+		opsError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// opsListEntry 从请求参数中读取要加入名单的条目，ttl为有效期(秒)，不填表示永久有效
+func opsListEntry(r *http.Request, list, target string) (*store.ListEntry, error) {
+	now := time.Now()
+	entry := &store.ListEntry{
+		List:      list,
+		Value:     target,
+		Amount:    r.FormValue("amount"),
+		Reason:    r.FormValue("reason"),
+		By:        opsOperator(r),
+		CreatedAt: now,
+	}
+	if v := r.FormValue("interval"); v != "" {
+		interval, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval %q", v)
+		}
+		entry.Interval = interval
+	}
+	if v := r.FormValue("unlimited"); v != "" {
+		unlimited, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unlimited %q", v)
+		}
+		entry.Unlimited = unlimited
+	}
+	if v := r.FormValue("ttl"); v != "" {
+		ttl, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || ttl == 0 {
+			return nil, fmt.Errorf("invalid ttl %q", v)
+		}
+		entry.ExpiresAt = now.Add(time.Duration(ttl) * time.Second)
+	}
+	return entry, nil
+}
+
+// opsListAudit 名单最近的修改记录
+func opsListAudit(w http.ResponseWriter, r *http.Request) {
+	limit, ok := opsLimit(w, r)
+	if !ok {
+		return
+	}
+	audits, err := db.ListAuditLog(limit)
+	if err != nil {
+		opsError(w, err)
+		return
+	}
+	if audits == nil {
+		audits = []*store.ListAudit{}
+	}
+	writeJSON(w, http.StatusOK, audits)
+}
+
+// opsListExport 把黑名单和白名单导出为csv
+func opsListExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv;charset=UTF-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=lists.csv")
+	if err := db.ExportLists(w); err != nil {
+		log.Println("export lists error:", err)
+	}
+}
+
+// opsListImport 从请求体中的csv导入名单，任意一行不正确时都不导入
+func opsListImport(w http.ResponseWriter, r *http.Request) {
+	if !opsMethod(w, r, http.MethodPost) {
+		return
+	}
+	by := opsOperator(r)
+	n, err := db.ImportLists(http.MaxBytesReader(w, r.Body, maxListCSV), by, time.Now())
+	if err != nil {
+		http.Error(w, "import lists error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("admin: %s imported %d list entries\n", by, n)
+	writeJSON(w, http.StatusOK, map[string]int{"imported": n})
+}
+
+// opsPayout 手动给地址打币，返回加入打币队列的申请
+func opsPayout(w http.ResponseWriter, r *http.Request) {
+	if !opsMethod(w, r, http.MethodPost) {
+		return
+	}
+	address := strings.TrimSpace(r.FormValue("address"))
+	if !fromLemoAddress(address) {
+		http.Error(w, "invalid lemo address", http.StatusBadRequest)
+		return
+	}
+	claim, err := manualPayout(address, opsOperator(r))
+	if err != nil {
+		opsError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, claim)
+}
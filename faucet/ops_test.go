@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/lemoTestCoin/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpsAuth(t *testing.T) {
+	conf = &config.Config{Ops: config.OpsConfig{Token: "secret"}}
+	defer func() { conf = nil }()
+	handler := opsAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	tests := []struct {
+		auth string
+		want int
+	}{
+		{"Bearer secret", http.StatusNoContent},
+		{"secret", http.StatusUnauthorized}, // 没有 Bearer 前缀
+		{"Basic secret", http.StatusUnauthorized},
+		{"bearer secret", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/ops/status", nil)
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != test.want {
+			t.Errorf("Authorization %q: status = %d, want %d", test.auth, w.Code, test.want)
+		}
+	}
+}
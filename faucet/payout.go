@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/lemoTestCoin/autoreply"
+	"github.com/lemoTestCoin/manager"
+	"github.com/lemoTestCoin/payout"
+	"github.com/lemoTestCoin/store"
+	"github.com/lemoTestCoin/types"
+	"log"
+	"math/big"
+	"time"
+)
+
+// sendCoin 适配payout.Sender
+func sendCoin(address string, amount *big.Int, expiration time.Time) (string, error) {
+	err, txHash := types.SendCoin(address, amount, uint64(expiration.Unix()))
+	return txHash, err
+}
+
+// lookupTx 适配payout.TxLookup
+func lookupTx(txHash string) (payout.TxStatus, error) {
+	tx, err := types.GetTxByHash(txHash)
+	if err != nil {
+		return payout.TxNotFound, err
+	}
+	if tx == nil {
+		return payout.TxNotFound, nil
+	}
+	if tx.IsPending {
+		return payout.TxPending, nil
+	}
+	return payout.TxConfirmed, nil
+}
+
+// notifyPayout 交易上链、过期或者发送失败后把交易hash或者失败原因推送给微信用户，并按规则给申请成功的用户打标签。
+// 到账通知配置了模板消息时优先发送模板消息，发送失败再改为客服消息
+func notifyPayout(record *store.ClaimRecord) {
+	if record.OpenID == "" {
+		return
+	}
+	var content string
+	if record.Status == store.StatusConfirmed {
+		// 按上链的申请次数给用户打标签，同一个标签只会打一次
+		if user, err := db.GetUser(record.OpenID); err == nil {
+			tagWorker.ClaimConfirmed(record.OpenID, user.Confirmed)
+		}
+		if conf.WeChat.PayoutTemplate.Id != "" {
+			err := sendPayoutTemplate(record, formatClaimAmount(record))
+			if err == nil {
+				return
+			}
+			log.Printf("send payout template message of claim %d error, send custom message instead: %v\n", record.ID, err)
+		}
+		content = replies.Text("payoutConfirmed", autoreply.Vars{"Amount": formatClaimAmount(record), "Address": record.Address, "TxHash": record.TxHash})
+	} else {
+		content = replies.Text("payoutFailed", autoreply.Vars{"Address": record.Address, "Error": record.Error})
+	}
+	if err := manager.SendCustomText(tokens, record.OpenID, content); err != nil {
+		log.Printf("send payout result of claim %d to user error: %v\n", record.ID, err)
+	}
+}
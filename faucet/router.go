@@ -0,0 +1,314 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"github.com/lemoTestCoin/autoreply"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 公众号消息路由。处理函数按消息类型、事件类型或文本匹配器注册，
+// 新增指令时只需要注册新的处理函数，不需要修改收发消息的核心逻辑
+
+// Context 一次微信消息请求的上下文
+type Context struct {
+	Writer  http.ResponseWriter
+	Request *http.Request
+	Msg     *Message
+	// 文本匹配器提取的参数，例如前缀匹配后剩余的内容、正则匹配的分组
+	Args []string
+
+	reply     []byte
+	encrypted bool
+}
+
+// Reply 设置回复给用户的xml
+func (c *Context) Reply(reply []byte) {
+	c.reply = reply
+}
+
+// ReplyMessage 按回复的类型回复用户文本、图文、图片、语音或音乐消息，reply为nil时不回复
+func (c *Context) ReplyMessage(reply *autoreply.Reply) {
+	if reply == nil {
+		return
+	}
+	body, err := makeResponseBody(c.Msg.ToUserName, c.Msg.FromUserName, reply)
+	if err != nil {
+		log.Println("Wechat Service: makeResponseBody error:", err)
+		return
+	}
+	c.reply = body
+}
+
+// ReplyText 回复用户文本消息
+func (c *Context) ReplyText(content string) {
+	reply, err := makeTextResponseBody(c.Msg.ToUserName, c.Msg.FromUserName, content)
+	if err != nil {
+		log.Println("Wechat Service: makeTextResponseBody error:", err)
+		return
+	}
+	c.reply = reply
+}
+
+// HandlerFunc 处理一条微信消息
+type HandlerFunc func(ctx *Context)
+
+// Middleware 包装HandlerFunc，用于签名校验、日志、panic恢复等通用逻辑
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Matcher 匹配用户发送的文本，匹配成功时返回提取的参数
+type Matcher func(content string) ([]string, bool)
+
+// Exact 文本和其中任意一个词完全相同
+func Exact(words ...string) Matcher {
+	return func(content string) ([]string, bool) {
+		for _, word := range words {
+			if content == word {
+				return []string{content}, true
+			}
+		}
+		return nil, false
+	}
+}
+
+// Prefix 文本以prefix开头，参数为去掉前缀后的内容
+func Prefix(prefix string) Matcher {
+	return func(content string) ([]string, bool) {
+		if !strings.HasPrefix(content, prefix) {
+			return nil, false
+		}
+		return []string{strings.TrimSpace(strings.TrimPrefix(content, prefix))}, true
+	}
+}
+
+// Regexp 文本匹配正则表达式，参数为匹配到的分组，第一个参数为整个匹配的内容
+func Regexp(expr string) Matcher {
+	re := regexp.MustCompile(expr)
+	return func(content string) ([]string, bool) {
+		args := re.FindStringSubmatch(content)
+		return args, args != nil
+	}
+}
+
+// LemoAddress 文本是一个Lemo地址
+func LemoAddress() Matcher {
+	return func(content string) ([]string, bool) {
+		if !fromLemoAddress(content) {
+			return nil, false
+		}
+		return []string{content}, true
+	}
+}
+
+type textRoute struct {
+	match   Matcher
+	handler HandlerFunc
+}
+
+// Router 根据消息类型分发微信推送的消息
+type Router struct {
+	handlers    map[string]HandlerFunc // key为消息类型，事件为 event/事件类型
+	texts       []textRoute            // 按注册顺序匹配，先注册的优先
+	fallback    HandlerFunc
+	middlewares []Middleware
+}
+
+// NewRouter 创建消息路由
+func NewRouter() *Router {
+	return &Router{handlers: make(map[string]HandlerFunc)}
+}
+
+// Use 添加中间件，先添加的中间件在最外层
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Handle 注册某种消息类型的处理函数，例如 text、image、voice、location、event。
+// 文本消息没有匹配到任何文本匹配器、事件没有注册对应的事件处理函数时使用
+func (r *Router) Handle(msgType string, handler HandlerFunc) {
+	r.handlers[msgType] = handler
+}
+
+// HandleEvent 注册某种事件的处理函数，例如 subscribe、SCAN、CLICK
+func (r *Router) HandleEvent(event string, handler HandlerFunc) {
+	r.handlers[eventRouteKey(event)] = handler
+}
+
+// Text 注册文本消息的处理函数
+func (r *Router) Text(match Matcher, handler HandlerFunc) {
+	r.texts = append(r.texts, textRoute{match: match, handler: handler})
+}
+
+// Fallback 没有任何处理函数时使用
+func (r *Router) Fallback(handler HandlerFunc) {
+	r.fallback = handler
+}
+
+// 事件类型大小写不统一(subscribe、SCAN)，统一转换为小写
+func eventRouteKey(event string) string {
+	return msgTypeEvent + "/" + strings.ToLower(event)
+}
+
+// ServeHTTP 处理微信服务器的请求
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	handler := r.serve
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		handler = r.middlewares[i](handler)
+	}
+	handler(&Context{Writer: w, Request: req})
+}
+
+// serve 读取并解析消息，分发给处理函数后把回复写回微信服务器
+func (r *Router) serve(ctx *Context) {
+	req := ctx.Request
+	// 微信服务器验证url时使用get请求，原样返回echostr
+	if req.Method == http.MethodGet {
+		fmt.Fprint(ctx.Writer, req.Form.Get("echostr"))
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(ctx.Writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		log.Println("io read error", err)
+		return
+	}
+	// 安全模式和兼容模式下解密消息，回复时使用和请求相同的方式
+	body, ctx.encrypted, err = decryptRequest(req, body)
+	if err != nil {
+		log.Println("Wechat service: decrypt request error:", err)
+		http.Error(ctx.Writer, "invalid message", http.StatusBadRequest)
+		return
+	}
+	ctx.Msg, err = parseMessage(body)
+	if err != nil {
+		log.Println("xml.Unmarshal error:", err)
+		http.Error(ctx.Writer, "invalid message", http.StatusBadRequest)
+		return
+	}
+	r.dispatch(ctx)
+	r.writeReply(ctx)
+}
+
+// dispatch 依次查找文本匹配器、事件处理函数、消息类型处理函数
+func (r *Router) dispatch(ctx *Context) {
+	msg := ctx.Msg
+	if msg.MsgType == msgTypeText {
+		content := strings.TrimSpace(msg.Content)
+		for _, route := range r.texts {
+			if args, ok := route.match(content); ok {
+				ctx.Args = args
+				route.handler(ctx)
+				return
+			}
+		}
+	}
+	if msg.MsgType == msgTypeEvent {
+		if handler, ok := r.handlers[eventRouteKey(msg.Event)]; ok {
+			handler(ctx)
+			return
+		}
+	}
+	if handler, ok := r.handlers[msg.MsgType]; ok {
+		handler(ctx)
+		return
+	}
+	if r.fallback != nil {
+		r.fallback(ctx)
+	}
+}
+
+// writeReply 把回复写回微信服务器，没有回复时返回success，微信服务器不会再重试
+func (r *Router) writeReply(ctx *Context) {
+	reply := ctx.reply
+	if reply == nil {
+		fmt.Fprint(ctx.Writer, "success")
+		return
+	}
+	if ctx.encrypted {
+		var err error
+		if reply, err = encryptResponse(reply); err != nil {
+			log.Println("Wechat Service: encrypt response error:", err)
+			fmt.Fprint(ctx.Writer, "success")
+			return
+		}
+	}
+	ctx.Writer.Header().Set("Content-Type", "text/xml")
+	ctx.Writer.Write(reply)
+}
+
+// makeSignature 生成签名
+func makeSignature(timestamp, nonce string) string {
+	s1 := []string{conf.WeChat.Token, timestamp, nonce}
+	sort.Strings(s1)
+	s := sha1.New()
+	io.WriteString(s, strings.Join(s1, ""))
+	return fmt.Sprintf("%x", s.Sum(nil))
+}
+
+// 请求中的timestamp与当前时间最多相差多久，避免重放截获的签名
+const maxSignatureAge = 5 * time.Minute
+
+// validateUrl 检验url是否来自微信，并且timestamp没有过期
+func validateUrl(r *http.Request) bool {
+	timestamp, err := strconv.ParseInt(r.Form.Get("timestamp"), 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return false
+	}
+	signatureGen := makeSignature(r.Form.Get("timestamp"), r.Form.Get("nonce"))
+	return signatureGen == r.Form.Get("signature")
+}
+
+// checkSignature 拒绝不是来自微信服务器的请求
+func checkSignature(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) {
+		if !validateUrl(ctx.Request) {
+			log.Println("Wechat service: this http request is not from Wechat platform !")
+			http.Error(ctx.Writer, "invalid signature", http.StatusForbidden)
+			return
+		}
+		next(ctx)
+	}
+}
+
+// logRequest 记录每条消息的类型和处理耗时
+func logRequest(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) {
+		start := time.Now()
+		next(ctx)
+		if ctx.Msg == nil {
+			log.Printf("Wechat Service: %s request, cost %s\n", ctx.Request.Method, time.Since(start))
+			return
+		}
+		log.Printf("Wechat Service: msgType=%s event=%s from=%s, cost %s\n", ctx.Msg.MsgType, ctx.Msg.Event, ctx.Msg.FromUserName, time.Since(start))
+	}
+}
+
+// recoverPanic 处理函数panic时记录错误，返回success避免微信提示公众号服务故障
+func recoverPanic(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("Wechat Service: handler panic: %v\n%s", err, debug.Stack())
+				fmt.Fprint(ctx.Writer, "success")
+			}
+		}()
+		next(ctx)
+	}
+}
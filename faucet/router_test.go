@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMatchers(t *testing.T) {
+	tests := []struct {
+		name    string
+		match   Matcher
+		content string
+		args    []string
+		ok      bool
+	}{
+		{"exact", Exact("余额", "balance"), "balance", []string{"balance"}, true},
+		{"exact no partial", Exact("余额"), "余额查询", nil, false},
+		{"prefix", Prefix("余额"), "余额 " + testAddress, []string{testAddress}, true},
+		{"prefix only", Prefix("#"), "#", []string{""}, true},
+		{"prefix mismatch", Prefix("余额"), "查询余额", nil, false},
+		{"regexp groups", Regexp(`^活动(\d+)$`), "活动12", []string{"活动12", "12"}, true},
+		{"regexp mismatch", Regexp(`^活动(\d+)$`), "活动", nil, false},
+		{"address", LemoAddress(), testAddress, []string{testAddress}, true},
+		{"address lower case", LemoAddress(), "lemo83w7hdzys33z745nz2fgf37565dsf5ahjz4j", []string{"lemo83w7hdzys33z745nz2fgf37565dsf5ahjz4j"}, true},
+		{"address too short", LemoAddress(), testAddress[:39], nil, false},
+	}
+	for _, test := range tests {
+		args, ok := test.match(test.content)
+		if ok != test.ok || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: match(%q) = %q, %v, want %q, %v", test.name, test.content, args, ok, test.args, test.ok)
+		}
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	var called string
+	handler := func(name string) HandlerFunc {
+		return func(ctx *Context) { called = name }
+	}
+	router := NewRouter()
+	router.Text(Prefix("#"), handler("admin"))
+	router.Text(Prefix("#帮助"), handler("help")) // 先注册的匹配器优先
+	router.Text(LemoAddress(), handler("claim"))
+	router.HandleEvent("SCAN", handler("scan"))
+	router.Handle(msgTypeText, handler("text"))
+	router.Handle(msgTypeEvent, handler("event"))
+	router.Fallback(handler("fallback"))
+
+	tests := []struct {
+		msg  Message
+		want string
+	}{
+		{Message{MsgType: msgTypeText, Content: "#帮助"}, "admin"},
+		{Message{MsgType: msgTypeText, Content: "  " + testAddress + "\n"}, "claim"},
+		{Message{MsgType: msgTypeText, Content: "你好"}, "text"},
+		{Message{MsgType: msgTypeEvent, Event: "scan"}, "scan"}, // 事件类型不区分大小写
+		{Message{MsgType: msgTypeEvent, Event: "CLICK"}, "event"},
+		{Message{MsgType: "image"}, "fallback"},
+	}
+	for _, test := range tests {
+		called = ""
+		msg := test.msg
+		router.dispatch(&Context{Msg: &msg})
+		if called != test.want {
+			t.Errorf("%s %q: handled by %q, want %q", msg.MsgType, msg.Content+msg.Event, called, test.want)
+		}
+	}
+}
+
+// 先添加的中间件在最外层
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx *Context) {
+				calls = append(calls, name+" before")
+				next(ctx)
+				calls = append(calls, name+" after")
+			}
+		}
+	}
+	router := NewRouter()
+	router.Use(trace("first"), trace("second"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?echostr=hello", nil))
+	want := []string{"first before", "second before", "second after", "first after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %q, want %q", calls, want)
+	}
+	if w.Body.String() != "hello" {
+		t.Fatalf("body = %q, want echostr", w.Body.String())
+	}
+}
+
+// 签名校验失败时不执行后面的中间件和处理函数，处理函数panic时返回success
+func TestMiddlewares(t *testing.T) {
+	router := setupWeChat(t, modePlaintext)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?echostr=hello&timestamp=1&nonce=n&signature=bad", nil))
+	if w.Code != http.StatusForbidden || w.Body.String() == "hello" {
+		t.Fatalf("invalid signature: status %d, body %q", w.Code, w.Body.String())
+	}
+
+	router = NewRouter()
+	router.Use(recoverPanic)
+	router.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) { panic("handler bug") }
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Body.String() != "success" {
+		t.Fatalf("body after panic = %q, want success", w.Body.String())
+	}
+}
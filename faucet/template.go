@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/lemoTestCoin/autoreply"
+	"github.com/lemoTestCoin/manager"
+	"github.com/lemoTestCoin/store"
+	"log"
+	"strings"
+	"time"
+)
+
+// sendPayoutTemplate 通过模板消息通知用户测试币已到账，模板消息不受48小时互动的限制。
+// 公众号中添加的模板内容需要包含以下字段:
+//
+//	{{first.DATA}}
+//	数量：{{keyword1.DATA}}
+//	地址：{{keyword2.DATA}}
+//	交易哈希：{{keyword3.DATA}}
+//	{{remark.DATA}}
+func sendPayoutTemplate(record *store.ClaimRecord, amount string) error {
+	vars := autoreply.Vars{"Amount": amount, "Address": record.Address, "TxHash": record.TxHash}
+	url := strings.NewReplacer("{txHash}", record.TxHash, "{address}", record.Address).Replace(conf.WeChat.PayoutTemplate.Url)
+	msg := &manager.TemplateMessage{
+		ToUser:     record.OpenID,
+		TemplateId: conf.WeChat.PayoutTemplate.Id,
+		Url:        url,
+		Data: map[string]*manager.TemplateData{
+			"first":    {Value: replies.Text("payoutTemplateFirst", vars)},
+			"keyword1": {Value: amount + " LEMO"},
+			"keyword2": {Value: record.Address},
+			"keyword3": {Value: record.TxHash},
+			"remark":   {Value: replies.Text("payoutTemplateRemark", vars)},
+		},
+	}
+	msgId, err := manager.SendTemplate(tokens, msg)
+	if dbErr := db.RecordTemplate(record.ID, record.OpenID, msgId, err, time.Now()); dbErr != nil {
+		log.Printf("record template message of claim %d error: %v\n", record.ID, dbErr)
+	}
+	return err
+}
+
+// handleTemplateFinish 微信推送的模板消息发送结果，不需要回复用户
+func handleTemplateFinish(ctx *Context) {
+	record, err := db.FinishTemplate(ctx.Msg.MsgID, ctx.Msg.Status, time.Now())
+	if err == store.ErrNotFound {
+		return
+	}
+	if err != nil {
+		log.Printf("record template message %d status error: %v\n", ctx.Msg.MsgID, err)
+		return
+	}
+	if record.Status != store.TemplateSuccess {
+		log.Printf("template message of claim %d to %s %s: %s\n", record.ClaimID, record.OpenID, record.Status, ctx.Msg.Status)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/lemoTestCoin/store"
+	"github.com/lemoTestCoin/web"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 网页的路径前缀，静态文件和网页使用的接口都在这个路径下:
+//
+//	GET  /faucet/                 网页
+//	GET  /faucet/api/challenge    获取工作量证明的题目
+//	POST /faucet/api/claim        {"address", "nonce", "solution"} 提交申请
+//	GET  /faucet/api/claim/{id}   查询申请的状态
+//	GET  /faucet/api/recent       最近到账的申请
+//
+// 申请的限制与http json接口相同，按客户端ip限制
+const webPrefix = "/faucet/"
+
+// 最近到账列表的条数，以及最多查找的申请条数
+const (
+	recentPayouts = 20
+	recentScan    = 1000
+)
+
+// recentPayout 最近到账的申请，数量以LEMO为单位
+type recentPayout struct {
+	Address string    `json:"address"`
+	Amount  string    `json:"amount"`
+	TxHash  string    `json:"txHash"`
+	Time    time.Time `json:"time"`
+}
+
+// registerWeb 注册网页的静态文件和接口
+func registerWeb() {
+	http.Handle(webPrefix, web.Handler(webPrefix))
+	http.HandleFunc(webPrefix+"api/", serveWebAPI)
+}
+
+// serveWebAPI 按路径分发网页使用的接口
+func serveWebAPI(w http.ResponseWriter, r *http.Request) {
+	if !apiLimiter.Allow(clientIP(r), time.Now()) {
+		writeAPIError(w, http.StatusTooManyRequests, "rate_limited", "too many requests", time.Minute)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, webPrefix+"api/")
+	switch {
+	case path == "challenge":
+		if checkMethod(w, r, http.MethodGet) {
+			serveChallenge(w, r)
+		}
+	case path == "claim":
+		if checkMethod(w, r, http.MethodPost) {
+			webClaim(w, r)
+		}
+	case strings.HasPrefix(path, "claim/"):
+		if checkMethod(w, r, http.MethodGet) {
+			apiGetClaim(w, strings.TrimPrefix(path, "claim/"))
+		}
+	case path == "recent":
+		if checkMethod(w, r, http.MethodGet) {
+			webRecent(w)
+		}
+	default:
+		writeAPIError(w, http.StatusNotFound, "not_found", "unknown api "+r.URL.Path, 0)
+	}
+}
+
+// webClaim 验证工作量证明后申请测试币，与 POST /api/v1/claim 相同返回202和申请记录
+func webClaim(w http.ResponseWriter, r *http.Request) {
+	req, err := readClaim(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "invalid request body: "+err.Error(), 0)
+		return
+	}
+	if !fromLemoAddress(req.Address) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_address", "invalid lemo address: "+req.Address, 0)
+		return
+	}
+	if !checkPoW(w, req) {
+		return
+	}
+	claim, err := db.ReserveIP(req.Address, clientIP(r), store.ChannelWeb, time.Now())
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+	payoutWorker.Wake()
+	writeJSON(w, http.StatusAccepted, newClaimResponse(claim))
+}
+
+// webRecent 最近到账的申请
+func webRecent(w http.ResponseWriter) {
+	records, err := db.RecentPayouts(recentPayouts, recentScan)
+	if err != nil {
+		log.Println("get recent payouts error:", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "get recent payouts failed", 0)
+		return
+	}
+	payouts := make([]*recentPayout, 0, len(records))
+	for _, record := range records {
+		payouts = append(payouts, &recentPayout{Address: record.Address, Amount: formatClaimAmount(record), TxHash: record.TxHash, Time: record.UpdatedAt})
+	}
+	writeJSON(w, http.StatusOK, payouts)
+}
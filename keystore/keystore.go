@@ -0,0 +1,272 @@
+// 水龙头打币账户的加密keystore，格式兼容web3 keystore v3:
+// 私钥经 scrypt/pbkdf2 派生的密钥做 aes-128-ctr 加密，mac 为 Keccak256(derivedKey[16:32] + ciphertext)
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lemoTestCoin/common/crypto"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	version = 3
+
+	KdfScrypt = "scrypt"
+	KdfPbkdf2 = "pbkdf2"
+
+	cipherName = "aes-128-ctr"
+
+	// 标准的scrypt参数，解密大约需要1秒、256M内存
+	StandardScryptN = 1 << 18
+	StandardScryptP = 1
+	// 轻量的scrypt参数，测试或者低配机器使用
+	LightScryptN = 1 << 12
+	LightScryptP = 6
+
+	scryptR     = 8
+	scryptDKLen = 32
+
+	pbkdf2Iterations = 262144
+	pbkdf2PRF        = "hmac-sha256"
+)
+
+var (
+	ErrDecrypt     = errors.New("could not decrypt key with given passphrase")
+	ErrUnknownKdf  = errors.New("unknown kdf")
+	ErrUnsupported = errors.New("unsupported keystore version or cipher")
+)
+
+// keystore文件的json结构
+type encryptedKeyJSON struct {
+	Address string     `json:"address"`
+	Crypto  cryptoJSON `json:"crypto"`
+	Id      string     `json:"id"`
+	Version int        `json:"version"`
+}
+
+type cryptoJSON struct {
+	Cipher       string                 `json:"cipher"`
+	CipherText   string                 `json:"ciphertext"`
+	CipherParams cipherparamsJSON       `json:"cipherparams"`
+	KDF          string                 `json:"kdf"`
+	KDFParams    map[string]interface{} `json:"kdfparams"`
+	MAC          string                 `json:"mac"`
+}
+
+type cipherparamsJSON struct {
+	IV string `json:"iv"`
+}
+
+// Options 加密参数，零值表示使用标准scrypt参数
+type Options struct {
+	KDF     string // KdfScrypt 或 KdfPbkdf2
+	ScryptN int
+	ScryptP int
+}
+
+// EncryptKey 用passphrase加密私钥，返回keystore的json数据
+func EncryptKey(key *ecdsa.PrivateKey, passphrase string, opts Options) ([]byte, error) {
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	kdfParams := map[string]interface{}{
+		"salt":  hex.EncodeToString(salt),
+		"dklen": scryptDKLen,
+	}
+	var derivedKey []byte
+	var err error
+	switch opts.KDF {
+	case "", KdfScrypt:
+		opts.KDF = KdfScrypt
+		if opts.ScryptN == 0 {
+			opts.ScryptN, opts.ScryptP = StandardScryptN, StandardScryptP
+		}
+		kdfParams["n"] = opts.ScryptN
+		kdfParams["r"] = scryptR
+		kdfParams["p"] = opts.ScryptP
+		derivedKey, err = scrypt.Key([]byte(passphrase), salt, opts.ScryptN, scryptR, opts.ScryptP, scryptDKLen)
+		if err != nil {
+			return nil, err
+		}
+	case KdfPbkdf2:
+		kdfParams["c"] = pbkdf2Iterations
+		kdfParams["prf"] = pbkdf2PRF
+		derivedKey = pbkdf2.Key([]byte(passphrase), salt, pbkdf2Iterations, scryptDKLen, sha256.New)
+	default:
+		return nil, ErrUnknownKdf
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	keyBytes := crypto.FromECDSA(key)
+	cipherText, err := aesCTRXOR(derivedKey[:16], keyBytes, iv)
+	if err != nil {
+		return nil, err
+	}
+	mac := crypto.Keccak256(derivedKey[16:32], cipherText)
+
+	return json.MarshalIndent(&encryptedKeyJSON{
+		Address: crypto.PubkeyToAddress(key.PublicKey).String(),
+		Crypto: cryptoJSON{
+			Cipher:       cipherName,
+			CipherText:   hex.EncodeToString(cipherText),
+			CipherParams: cipherparamsJSON{IV: hex.EncodeToString(iv)},
+			KDF:          opts.KDF,
+			KDFParams:    kdfParams,
+			MAC:          hex.EncodeToString(mac),
+		},
+		Id:      newId(),
+		Version: version,
+	}, "", "  ")
+}
+
+// DecryptKey 用passphrase解密keystore的json数据，返回私钥
+func DecryptKey(keyjson []byte, passphrase string) (*ecdsa.PrivateKey, error) {
+	k := new(encryptedKeyJSON)
+	if err := json.Unmarshal(keyjson, k); err != nil {
+		return nil, err
+	}
+	if k.Version != version || k.Crypto.Cipher != cipherName {
+		return nil, ErrUnsupported
+	}
+	mac, err := hex.DecodeString(k.Crypto.MAC)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hex.DecodeString(k.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, err
+	}
+	cipherText, err := hex.DecodeString(k.Crypto.CipherText)
+	if err != nil {
+		return nil, err
+	}
+	derivedKey, err := deriveKey(&k.Crypto, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(crypto.Keccak256(derivedKey[16:32], cipherText), mac) != 1 {
+		return nil, ErrDecrypt
+	}
+	plainText, err := aesCTRXOR(derivedKey[:16], cipherText, iv)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.ToECDSA(plainText)
+	if err != nil {
+		return nil, err
+	}
+	// 校验文件中记录的地址
+	if address := crypto.PubkeyToAddress(key.PublicKey).String(); k.Address != "" && k.Address != address {
+		return nil, fmt.Errorf("key address %s does not match keystore address %s", address, k.Address)
+	}
+	return key, nil
+}
+
+// KeyAddress 返回keystore文件中记录的地址，不需要解密
+func KeyAddress(keyjson []byte) (string, error) {
+	k := new(encryptedKeyJSON)
+	if err := json.Unmarshal(keyjson, k); err != nil {
+		return "", err
+	}
+	return k.Address, nil
+}
+
+// LoadKey 读取keystore文件并解密
+func LoadKey(path, passphrase string) (*ecdsa.PrivateKey, error) {
+	keyjson, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptKey(keyjson, passphrase)
+}
+
+// StoreKey 加密私钥并写入keystore文件，文件权限为0600，不覆盖已存在的文件
+func StoreKey(path string, key *ecdsa.PrivateKey, passphrase string, opts Options) error {
+	keyjson, err := EncryptKey(key, passphrase, opts)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(keyjson); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// deriveKey 根据kdf参数派生出对称密钥
+func deriveKey(c *cryptoJSON, passphrase string) ([]byte, error) {
+	saltHex, _ := c.KDFParams["salt"].(string)
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return nil, err
+	}
+	dkLen := paramInt(c.KDFParams, "dklen")
+	if dkLen < 32 {
+		return nil, errors.New("invalid kdf dklen")
+	}
+	switch c.KDF {
+	case KdfScrypt:
+		n := paramInt(c.KDFParams, "n")
+		r := paramInt(c.KDFParams, "r")
+		p := paramInt(c.KDFParams, "p")
+		return scrypt.Key([]byte(passphrase), salt, n, r, p, dkLen)
+	case KdfPbkdf2:
+		if prf, _ := c.KDFParams["prf"].(string); prf != pbkdf2PRF {
+			return nil, fmt.Errorf("unsupported pbkdf2 prf: %s", prf)
+		}
+		iter := paramInt(c.KDFParams, "c")
+		return pbkdf2.Key([]byte(passphrase), salt, iter, dkLen, sha256.New), nil
+	}
+	return nil, ErrUnknownKdf
+}
+
+// paramInt json反序列化出来的数字为float64
+func paramInt(params map[string]interface{}, name string) int {
+	f, _ := params[name].(float64)
+	return int(f)
+}
+
+func aesCTRXOR(key, inText, iv []byte) ([]byte, error) {
+	aesBlock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	stream := cipher.NewCTR(aesBlock, iv)
+	outText := make([]byte, len(inText))
+	stream.XORKeyStream(outText, inText)
+	return outText, nil
+}
+
+// newId 生成随机的uuid v4
+func newId() string {
+	u := make([]byte, 16)
+	io.ReadFull(rand.Reader, u)
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
@@ -0,0 +1,99 @@
+package keystore
+
+import (
+	"bytes"
+	"github.com/lemoTestCoin/common/crypto"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// 测试使用轻量的scrypt参数
+var testOptions = Options{KDF: KdfScrypt, ScryptN: LightScryptN, ScryptP: LightScryptP}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []Options{testOptions, {KDF: KdfPbkdf2}} {
+		keyjson, err := EncryptKey(key, "foo", opts)
+		if err != nil {
+			t.Fatalf("%s: %v", opts.KDF, err)
+		}
+		decrypted, err := DecryptKey(keyjson, "foo")
+		if err != nil {
+			t.Fatalf("%s: %v", opts.KDF, err)
+		}
+		if !bytes.Equal(crypto.FromECDSA(decrypted), crypto.FromECDSA(key)) {
+			t.Fatalf("%s: decrypted key does not match", opts.KDF)
+		}
+		address, err := KeyAddress(keyjson)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := crypto.PubkeyToAddress(key.PublicKey).String(); address != want {
+			t.Fatalf("%s: address = %s, want %s", opts.KDF, address, want)
+		}
+	}
+}
+
+func TestDecryptWrongPassphrase(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyjson, err := EncryptKey(key, "foo", testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = DecryptKey(keyjson, "bar"); err != ErrDecrypt {
+		t.Fatalf("decrypt with wrong passphrase returned %v, want %v", err, ErrDecrypt)
+	}
+	if _, err = DecryptKey(keyjson, ""); err != ErrDecrypt {
+		t.Fatalf("decrypt with empty passphrase returned %v, want %v", err, ErrDecrypt)
+	}
+}
+
+func TestStoreLoadKey(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys", "sender.json")
+	if err = StoreKey(path, key, "foo", testOptions); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadKey(path, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(crypto.FromECDSA(loaded), crypto.FromECDSA(key)) {
+		t.Fatal("loaded key does not match")
+	}
+	// 不覆盖已存在的文件
+	if err = StoreKey(path, key, "bar", testOptions); err == nil {
+		t.Fatal("StoreKey should not overwrite an existing keystore")
+	}
+}
+
+func TestReadPassphrase(t *testing.T) {
+	passFile := filepath.Join(t.TempDir(), "pass")
+	if err := ioutil.WriteFile(passFile, []byte("foo bar\r\nsecond line\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_KEYSTORE_PASS", "env")
+	pass, err := ReadPassphrase(passFile, "TEST_KEYSTORE_PASS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pass != "foo bar" {
+		t.Fatalf("passphrase = %q, want %q", pass, "foo bar")
+	}
+	if pass, err = ReadPassphrase("", "TEST_KEYSTORE_PASS"); err != nil || pass != "env" {
+		t.Fatalf("passphrase from env = %q, %v", pass, err)
+	}
+	if _, err = ReadPassphrase("", "TEST_KEYSTORE_PASS_MISSING"); err != ErrNoPassphrase {
+		t.Fatalf("missing passphrase returned %v, want %v", err, ErrNoPassphrase)
+	}
+}
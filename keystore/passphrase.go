@@ -0,0 +1,29 @@
+package keystore
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ErrNoPassphrase 没有配置keystore的密码
+var ErrNoPassphrase = errors.New("keystore passphrase not provided, set a passphrase file or env")
+
+// ReadPassphrase 获取keystore的密码，优先读取passFile文件，其次读取环境变量envName。
+// 文件中只取第一行，去掉行尾的换行符
+func ReadPassphrase(passFile, envName string) (string, error) {
+	if passFile != "" {
+		data, err := ioutil.ReadFile(passFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(strings.SplitN(string(data), "\n", 2)[0], "\r"), nil
+	}
+	if envName != "" {
+		if pass, ok := os.LookupEnv(envName); ok {
+			return pass, nil
+		}
+	}
+	return "", ErrNoPassphrase
+}
@@ -0,0 +1,91 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// BaseResponse 微信接口返回的公共字段，errcode为0表示成功
+type BaseResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// APIError 微信接口返回的错误
+type APIError struct {
+	Api     string // 调用的接口
+	ErrCode int
+	ErrMsg  string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("wechat api %s error: errcode=%d errmsg=%s", e.Api, e.ErrCode, e.ErrMsg)
+}
+
+// ResponseError 微信接口返回的内容不能解析，重试也不会成功
+type ResponseError struct {
+	Api      string // 调用的接口
+	Response []byte
+	Err      error // 反序列化的错误
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("wechat api %s invalid response %q: %v", e.Api, e.Response, e.Err)
+}
+
+// TokenInvalid access_token失效，刷新access_token后可以重试
+func (e *APIError) TokenInvalid() bool {
+	return tokenInvalidCodes[e.ErrCode]
+}
+
+// Retryable 稍后重试可能成功的错误，其他错误(例如appsecret错误、ip不在白名单、参数错误)重试也不会成功
+func (e *APIError) Retryable() bool {
+	return e.TokenInvalid() || retryableCodes[e.ErrCode]
+}
+
+// 微信返回这些错误码时表示access_token已经失效，需要强制刷新
+var tokenInvalidCodes = map[int]bool{
+	40001: true, // access_token无效或不是最新的
+	40014: true, // 不合法的access_token
+	42001: true, // access_token超时
+}
+
+// 稍后重试可能成功的错误码
+var retryableCodes = map[int]bool{
+	-1:    true, // 系统繁忙
+	45009: true, // 接口调用超过限制
+	45011: true, // API调用太频繁
+	45047: true, // 客服接口下行条数超过上限
+}
+
+// IsRetryable 判断错误是否可以稍后重试，网络错误也可以重试，返回内容不能解析时不重试
+func IsRetryable(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *APIError:
+		return e.Retryable()
+	case *ResponseError:
+		return false
+	default:
+		return true
+	}
+}
+
+// parseResponse 检查微信返回的errcode，成功时把响应反序列化到result中，result可以为nil
+func parseResponse(api string, res []byte, result interface{}) error {
+	base := new(BaseResponse)
+	if err := json.Unmarshal(res, base); err != nil {
+		return &ResponseError{Api: api, Response: res, Err: err}
+	}
+	if base.ErrCode != 0 {
+		return &APIError{Api: api, ErrCode: base.ErrCode, ErrMsg: base.ErrMsg}
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(res, result); err != nil {
+		return &ResponseError{Api: api, Response: res, Err: err}
+	}
+	return nil
+}
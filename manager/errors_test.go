@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		res  string
+		err  error
+		want bool
+	}{
+		{name: "success", res: `{"errcode":0,"errmsg":"ok"}`, want: false},
+		{name: "system busy", res: `{"errcode":-1,"errmsg":"system error"}`, want: true},
+		{name: "token expired", res: `{"errcode":42001,"errmsg":"access_token expired"}`, want: true},
+		{name: "invalid appsecret", res: `{"errcode":40125,"errmsg":"invalid appsecret"}`, want: false},
+		{name: "malformed response", res: `<html>502 Bad Gateway</html>`, want: false},
+		{name: "wrong field type", res: `{"errcode":0,"tag":{"id":"x"}}`, want: false},
+		{name: "network error", err: errors.New("dial tcp: i/o timeout"), want: true},
+	}
+	for _, test := range tests {
+		err := test.err
+		if err == nil {
+			err = parseResponse("tags/create", []byte(test.res), &UnmarshalTag{})
+		}
+		if got := IsRetryable(err); got != test.want {
+			t.Errorf("%s: IsRetryable(%v) = %v, want %v", test.name, err, got, test.want)
+		}
+	}
+}
+
+func TestParseResponseError(t *testing.T) {
+	err := parseResponse("tags/create", []byte("not json"), nil)
+	if _, ok := err.(*ResponseError); !ok {
+		t.Fatalf("parseResponse returned %T, want *ResponseError", err)
+	}
+	err = parseResponse("tags/create", []byte(`{"errcode":45009,"errmsg":"reach max api daily quota limit"}`), nil)
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.ErrCode != 45009 {
+		t.Fatalf("parseResponse returned %v, want APIError 45009", err)
+	}
+}
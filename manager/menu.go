@@ -0,0 +1,131 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// 菜单的限制: 最多3个一级菜单，每个一级菜单最多5个二级菜单
+const (
+	maxMenuButtons    = 3
+	maxMenuSubButtons = 5
+)
+
+// 菜单不存在的错误码
+const errCodeMenuNotExist = 46003
+
+// 菜单按钮，有子菜单的按钮只需要name和sub_button
+type Button struct {
+	Type      string    `json:"type,omitempty"` // click、view、miniprogram、scancode_push等
+	Name      string    `json:"name"`
+	Key       string    `json:"key,omitempty"` // click等事件类型的按钮推送给服务器的EventKey
+	Url       string    `json:"url,omitempty"` // view类型的按钮打开的网页
+	MediaId   string    `json:"media_id,omitempty"`
+	AppId     string    `json:"appid,omitempty"`
+	PagePath  string    `json:"pagepath,omitempty"`
+	SubButton []*Button `json:"sub_button,omitempty"`
+}
+
+// 个性化菜单的匹配规则，至少设置一项
+type MatchRule struct {
+	TagId              string `json:"tag_id,omitempty"`
+	Sex                string `json:"sex,omitempty"`
+	Country            string `json:"country,omitempty"`
+	Province           string `json:"province,omitempty"`
+	City               string `json:"city,omitempty"`
+	ClientPlatformType string `json:"client_platform_type,omitempty"`
+	Language           string `json:"language,omitempty"`
+}
+
+// 菜单，MatchRule不为nil时为个性化菜单
+type Menu struct {
+	Button    []*Button   `json:"button"`
+	MatchRule *MatchRule  `json:"matchrule,omitempty"`
+	MenuId    json.Number `json:"menuid,omitempty"`
+}
+
+// 查询菜单返回的数据结构，包括默认菜单和个性化菜单
+type MenuConfig struct {
+	Menu            *Menu   `json:"menu"`
+	ConditionalMenu []*Menu `json:"conditionalmenu,omitempty"`
+}
+
+// 创建个性化菜单返回的数据结构
+type ConditionalMenuId struct {
+	MenuId json.Number `json:"menuid"`
+}
+
+// Validate 检查菜单按钮的数量和名字长度
+func (m *Menu) Validate() error {
+	if len(m.Button) == 0 || len(m.Button) > maxMenuButtons {
+		return fmt.Errorf("menu needs 1 to %d buttons, got %d", maxMenuButtons, len(m.Button))
+	}
+	for _, button := range m.Button {
+		if len(button.SubButton) > maxMenuSubButtons {
+			return fmt.Errorf("menu button %s has more than %d sub buttons", button.Name, maxMenuSubButtons)
+		}
+		buttons := append([]*Button{button}, button.SubButton...)
+		for _, b := range buttons {
+			if b.Name == "" || utf8.RuneCountInString(b.Name) > 30 {
+				return fmt.Errorf("invalid menu button name %q", b.Name)
+			}
+			if b != button || len(button.SubButton) == 0 {
+				if b.Type == "" {
+					return fmt.Errorf("menu button %s has no type", b.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 14.创建默认菜单，会覆盖已有的默认菜单
+func CreateMenu(tokens *TokenManager, menu *Menu) error {
+	if menu.MatchRule != nil {
+		return fmt.Errorf("default menu can not have matchrule")
+	}
+	if err := menu.Validate(); err != nil {
+		return err
+	}
+	return tokens.call("menu/create", "https://api.weixin.qq.com/cgi-bin/menu/create?access_token=ACCESS_TOKEN", &Menu{Button: menu.Button}, nil)
+}
+
+// 15.查询默认菜单和个性化菜单，没有菜单时返回空的MenuConfig
+func GetMenu(tokens *TokenManager) (*MenuConfig, error) {
+	config := &MenuConfig{}
+	err := tokens.call("menu/get", "https://api.weixin.qq.com/cgi-bin/menu/get?access_token=ACCESS_TOKEN", nil, config)
+	if apiErr, ok := err.(*APIError); ok && apiErr.ErrCode == errCodeMenuNotExist {
+		return &MenuConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// 16.删除默认菜单和全部个性化菜单
+func DeleteMenu(tokens *TokenManager) error {
+	return tokens.call("menu/delete", "https://api.weixin.qq.com/cgi-bin/menu/delete?access_token=ACCESS_TOKEN", nil, nil)
+}
+
+// 17.创建个性化菜单，必须先有默认菜单，返回菜单id
+func AddConditionalMenu(tokens *TokenManager, menu *Menu) (string, error) {
+	if menu.MatchRule == nil {
+		return "", fmt.Errorf("conditional menu needs matchrule")
+	}
+	if err := menu.Validate(); err != nil {
+		return "", err
+	}
+	result := &ConditionalMenuId{}
+	err := tokens.call("menu/addconditional", "https://api.weixin.qq.com/cgi-bin/menu/addconditional?access_token=ACCESS_TOKEN", &Menu{Button: menu.Button, MatchRule: menu.MatchRule}, result)
+	if err != nil {
+		return "", err
+	}
+	return result.MenuId.String(), nil
+}
+
+// 18.删除个性化菜单
+func DeleteConditionalMenu(tokens *TokenManager, menuId string) error {
+	return tokens.call("menu/delconditional", "https://api.weixin.qq.com/cgi-bin/menu/delconditional?access_token=ACCESS_TOKEN", &ConditionalMenuId{MenuId: json.Number(menuId)}, nil)
+}
@@ -0,0 +1,102 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 二维码类型
+const (
+	QRScene         = "QR_SCENE"           // 临时二维码，整型场景值
+	QRStrScene      = "QR_STR_SCENE"       // 临时二维码，字符串场景值
+	QRLimitScene    = "QR_LIMIT_SCENE"     // 永久二维码，整型场景值，取值1到100000
+	QRLimitStrScene = "QR_LIMIT_STR_SCENE" // 永久二维码，字符串场景值，长度1到64
+)
+
+// 临时二维码最长的有效期，30天
+const MaxQRCodeExpireSeconds = 30 * 24 * 3600
+
+// 永久二维码整型场景值的最大值
+const maxLimitSceneId = 100000
+
+// 创建二维码的数据结构
+type QRCodeRequest struct {
+	ExpireSeconds int          `json:"expire_seconds,omitempty"`
+	ActionName    string       `json:"action_name"`
+	ActionInfo    QRActionInfo `json:"action_info"`
+}
+type QRActionInfo struct {
+	Scene QRSceneParam `json:"scene"`
+}
+type QRSceneParam struct {
+	SceneId  int    `json:"scene_id,omitempty"`
+	SceneStr string `json:"scene_str,omitempty"`
+}
+
+// 创建二维码返回的数据结构，Url为二维码图片解析后的地址
+type QRCode struct {
+	Ticket        string `json:"ticket"`
+	ExpireSeconds int    `json:"expire_seconds"`
+	Url           string `json:"url"`
+}
+
+// 6.创建带参数的二维码，用户扫码时场景值scene会在关注和扫码事件的EventKey中推送过来。
+// expireSeconds为0时创建永久二维码，否则创建有效期为expireSeconds秒的临时二维码。
+// 整数形式的scene使用整型场景值，其他使用字符串场景值
+func CreateQRCode(tokens *TokenManager, scene string, expireSeconds int) (*QRCode, error) {
+	if scene == "" || len(scene) > 64 {
+		return nil, fmt.Errorf("invalid qrcode scene %q", scene)
+	}
+	if expireSeconds < 0 || expireSeconds > MaxQRCodeExpireSeconds {
+		return nil, fmt.Errorf("qrcode expire seconds must be in [0, %d]", MaxQRCodeExpireSeconds)
+	}
+	req := &QRCodeRequest{ExpireSeconds: expireSeconds}
+	sceneId, err := strconv.Atoi(scene)
+	if err == nil && sceneId > 0 && (expireSeconds > 0 || sceneId <= maxLimitSceneId) {
+		req.ActionInfo.Scene.SceneId = sceneId
+		req.ActionName = QRScene
+		if expireSeconds == 0 {
+			req.ActionName = QRLimitScene
+		}
+	} else {
+		req.ActionInfo.Scene.SceneStr = scene
+		req.ActionName = QRStrScene
+		if expireSeconds == 0 {
+			req.ActionName = QRLimitStrScene
+		}
+	}
+	qrcode := &QRCode{}
+	if err = tokens.call("qrcode/create", "https://api.weixin.qq.com/cgi-bin/qrcode/create?access_token=ACCESS_TOKEN", req, qrcode); err != nil {
+		return nil, err
+	}
+	if qrcode.Ticket == "" {
+		return nil, fmt.Errorf("wechat api qrcode/create returned no ticket")
+	}
+	return qrcode, nil
+}
+
+// QRCodeImageUrl 用ticket换取二维码图片的地址，不需要access_token
+func QRCodeImageUrl(ticket string) string {
+	return "https://mp.weixin.qq.com/cgi-bin/showqrcode?ticket=" + url.QueryEscape(ticket)
+}
+
+// 7.用ticket下载二维码图片(jpg)
+func ShowQRCode(ticket string) ([]byte, error) {
+	resp, err := httpClient.Get(QRCodeImageUrl(ticket))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// ticket错误时返回的是http错误或者json格式的错误信息
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+		return nil, fmt.Errorf("wechat showqrcode failed: status %d, %s", resp.StatusCode, data)
+	}
+	return data, nil
+}
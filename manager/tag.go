@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"fmt"
+)
+
+// 批量打标签和取消标签每次最多50个用户
+const MaxTagBatch = 50
+
+// 编辑和删除标签的数据结构
+type UpdateTagParam struct {
+	Tag *TagParam `json:"tag"`
+}
+
+// 获取用户身上的标签的数据结构
+type UserTagsParam struct {
+	OpenId string `json:"openid"`
+}
+type UserTags struct {
+	TagIdList []int `json:"tagid_list"`
+}
+
+// 获取标签下粉丝列表的数据结构
+type TagUsersParam struct {
+	TagId      int    `json:"tagid"`
+	NextOpenId string `json:"next_openid"`
+}
+type TagUsers struct {
+	Count int `json:"count"`
+	Data  struct {
+		OpenId []string `json:"openid"`
+	} `json:"data"`
+	NextOpenId string `json:"next_openid"`
+}
+
+// 8.获取公众号已创建的所有标签
+func ListTags(tokens *TokenManager) ([]TagMsg, error) {
+	findTagName := &FindTagName{Tags: []TagMsg{}}
+	if err := tokens.call("tags/get", "https://api.weixin.qq.com/cgi-bin/tags/get?access_token=ACCESS_TOKEN", nil, findTagName); err != nil {
+		return nil, err
+	}
+	return findTagName.Tags, nil
+}
+
+// 9.修改标签的名字
+func UpdateTag(tokens *TokenManager, id int, name string) error {
+	param := &UpdateTagParam{Tag: &TagParam{Id: id, Name: name}}
+	return tokens.call("tags/update", "https://api.weixin.qq.com/cgi-bin/tags/update?access_token=ACCESS_TOKEN", param, nil)
+}
+
+// 10.删除标签，标签下的用户会被取消这个标签
+func DeleteTag(tokens *TokenManager, id int) error {
+	param := &UpdateTagParam{Tag: &TagParam{Id: id}}
+	return tokens.call("tags/delete", "https://api.weixin.qq.com/cgi-bin/tags/delete?access_token=ACCESS_TOKEN", param, nil)
+}
+
+// 11.批量为用户取消标签，openIds最多50个
+func RemoveTagForUser(tokens *TokenManager, openIds []string, id int) error {
+	if len(openIds) == 0 || len(openIds) > MaxTagBatch {
+		return fmt.Errorf("batch untagging needs 1 to %d openids, got %d", MaxTagBatch, len(openIds))
+	}
+	playtag := &PlayTag{
+		OpenidList: openIds,
+		Tagid:      id,
+	}
+	return tokens.call("tags/members/batchuntagging", "https://api.weixin.qq.com/cgi-bin/tags/members/batchuntagging?access_token=ACCESS_TOKEN", playtag, nil)
+}
+
+// 12.分页获取标签下的用户，nextOpenId为空时从头开始，每页最多10000个。
+// 返回的nextOpenId为下一页的起点，为空表示已经是最后一页
+func GetTagUsers(tokens *TokenManager, id int, nextOpenId string) ([]string, string, error) {
+	param := &TagUsersParam{TagId: id, NextOpenId: nextOpenId}
+	users := &TagUsers{}
+	if err := tokens.call("user/tag/get", "https://api.weixin.qq.com/cgi-bin/user/tag/get?access_token=ACCESS_TOKEN", param, users); err != nil {
+		return nil, "", err
+	}
+	if users.Count == 0 {
+		return nil, "", nil
+	}
+	return users.Data.OpenId, users.NextOpenId, nil
+}
+
+// 13.获取用户身上的标签id
+func GetUserTags(tokens *TokenManager, openId string) ([]int, error) {
+	tags := &UserTags{}
+	if err := tokens.call("tags/getidlist", "https://api.weixin.qq.com/cgi-bin/tags/getidlist?access_token=ACCESS_TOKEN", &UserTagsParam{OpenId: openId}, tags); err != nil {
+		return nil, err
+	}
+	return tags.TagIdList, nil
+}
@@ -0,0 +1,113 @@
+package manager
+
+// 模板消息中的一个字段，模板内容中的 {{keyword1.DATA}} 对应 Data["keyword1"]
+type TemplateData struct {
+	Value string `json:"value"`
+	Color string `json:"color,omitempty"`
+}
+
+// 点击模板消息跳转的小程序
+type TemplateMiniProgram struct {
+	AppId    string `json:"appid"`
+	PagePath string `json:"pagepath,omitempty"`
+}
+
+// 发送模板消息的数据结构
+type TemplateMessage struct {
+	ToUser      string                   `json:"touser"`
+	TemplateId  string                   `json:"template_id"`
+	Url         string                   `json:"url,omitempty"`
+	MiniProgram *TemplateMiniProgram     `json:"miniprogram,omitempty"`
+	Data        map[string]*TemplateData `json:"data"`
+}
+
+// 发送模板消息返回的数据结构
+type TemplateMsgId struct {
+	MsgId int64 `json:"msgid"`
+}
+
+// 公众号的模板
+type Template struct {
+	TemplateId      string `json:"template_id"`
+	Title           string `json:"title"`
+	PrimaryIndustry string `json:"primary_industry"`
+	DeputyIndustry  string `json:"deputy_industry"`
+	Content         string `json:"content"`
+	Example         string `json:"example"`
+}
+
+// 获取模板列表返回的数据结构
+type TemplateList struct {
+	TemplateList []*Template `json:"template_list"`
+}
+
+// 添加和删除模板的数据结构
+type AddTemplateParam struct {
+	TemplateIdShort string `json:"template_id_short"`
+}
+type TemplateIdParam struct {
+	TemplateId string `json:"template_id"`
+}
+
+// 设置所属行业的数据结构，行业代码见微信文档
+type SetIndustryParam struct {
+	IndustryId1 string `json:"industry_id1"`
+	IndustryId2 string `json:"industry_id2"`
+}
+
+// 公众号设置的行业
+type IndustryClass struct {
+	FirstClass  string `json:"first_class"`
+	SecondClass string `json:"second_class"`
+}
+type Industry struct {
+	PrimaryIndustry   IndustryClass `json:"primary_industry"`
+	SecondaryIndustry IndustryClass `json:"secondary_industry"`
+}
+
+// 19.发送模板消息，返回消息id，发送结果通过 TEMPLATESENDJOBFINISH 事件推送
+func SendTemplate(tokens *TokenManager, msg *TemplateMessage) (int64, error) {
+	result := &TemplateMsgId{}
+	if err := tokens.call("message/template/send", "https://api.weixin.qq.com/cgi-bin/message/template/send?access_token=ACCESS_TOKEN", msg, result); err != nil {
+		return 0, err
+	}
+	return result.MsgId, nil
+}
+
+// 20.获取公众号添加的全部模板
+func ListTemplates(tokens *TokenManager) ([]*Template, error) {
+	list := &TemplateList{}
+	if err := tokens.call("template/get_all_private_template", "https://api.weixin.qq.com/cgi-bin/template/get_all_private_template?access_token=ACCESS_TOKEN", nil, list); err != nil {
+		return nil, err
+	}
+	return list.TemplateList, nil
+}
+
+// 21.从模板库添加模板，返回模板id
+func AddTemplate(tokens *TokenManager, shortId string) (string, error) {
+	result := &TemplateIdParam{}
+	if err := tokens.call("template/api_add_template", "https://api.weixin.qq.com/cgi-bin/template/api_add_template?access_token=ACCESS_TOKEN", &AddTemplateParam{TemplateIdShort: shortId}, result); err != nil {
+		return "", err
+	}
+	return result.TemplateId, nil
+}
+
+// 22.删除模板
+func DeleteTemplate(tokens *TokenManager, templateId string) error {
+	return tokens.call("template/del_private_template", "https://api.weixin.qq.com/cgi-bin/template/del_private_template?access_token=ACCESS_TOKEN", &TemplateIdParam{TemplateId: templateId}, nil)
+}
+
+// 23.设置公众号所属行业，每月只能修改一次
+func SetIndustry(tokens *TokenManager, industryId1, industryId2 string) error {
+	param := &SetIndustryParam{IndustryId1: industryId1, IndustryId2: industryId2}
+	return tokens.call("template/api_set_industry", "https://api.weixin.qq.com/cgi-bin/template/api_set_industry?access_token=ACCESS_TOKEN", param, nil)
+}
+
+// 24.获取公众号设置的行业
+func GetIndustry(tokens *TokenManager) (*Industry, error) {
+	industry := &Industry{}
+	if err := tokens.call("template/get_industry", "https://api.weixin.qq.com/cgi-bin/template/get_industry?access_token=ACCESS_TOKEN", nil, industry); err != nil {
+		return nil, err
+	}
+	return industry, nil
+}
@@ -0,0 +1,219 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	refreshAhead   = 5 * time.Minute // 提前多久刷新access_token
+	minBackoff     = time.Second     // 获取access_token失败后重试的最短间隔
+	maxBackoff     = time.Minute     // 获取access_token失败后重试的最长间隔
+	defaultExpires = 7200            // 微信没有返回expires_in时使用的有效期，单位秒
+)
+
+var errTokenNotReady = errors.New("access_token is not ready")
+
+// TokenManager 持有公众号的access_token，在过期之前自动刷新，可以被多个goroutine并发使用。
+// 所有调用微信接口的函数都通过TokenManager获取access_token
+type TokenManager struct {
+	appId     string
+	appSecret string
+	fetch     func(appId, appSecret string) (string, int, error) // 从微信获取access_token，测试时替换
+
+	refreshMu sync.Mutex // 保证同一时间只有一个刷新，微信每次刷新都会使之前的access_token失效
+	mu        sync.RWMutex
+	token     string
+	expireAt  time.Time
+
+	refresh chan struct{} // 通知后台goroutine按新的过期时间重新计时
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewTokenManager 创建appId对应公众号的TokenManager，需要调用Start获取第一个access_token
+func NewTokenManager(appId, appSecret string) *TokenManager {
+	return &TokenManager{
+		appId:     appId,
+		appSecret: appSecret,
+		fetch:     fetchAccessToken,
+		refresh:   make(chan struct{}, 1),
+		quit:      make(chan struct{}),
+	}
+}
+
+// Start 获取第一个access_token，然后启动后台定时刷新
+func (m *TokenManager) Start() error {
+	if err := m.update(); err != nil {
+		return err
+	}
+	m.wg.Add(1)
+	go m.loop()
+	return nil
+}
+
+// Stop 停止后台刷新
+func (m *TokenManager) Stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+
+// Token 返回当前的access_token
+func (m *TokenManager) Token() (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.token == "" {
+		return "", errTokenNotReady
+	}
+	return m.token, nil
+}
+
+// Invalidate 微信返回access_token失效时调用，如果失效的token仍是当前的token则立即刷新。
+// 并发调用时只有第一个刷新，其它调用等待刷新完成后直接使用新的token
+func (m *TokenManager) Invalidate(token string) error {
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+	m.mu.RLock()
+	current := m.token
+	m.mu.RUnlock()
+	if current != token {
+		return nil
+	}
+	if err := m.fetchToken(); err != nil {
+		return err
+	}
+	select {
+	case m.refresh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// update 从微信获取新的access_token
+func (m *TokenManager) update() error {
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+	return m.fetchToken()
+}
+
+// fetchToken 获取并保存新的access_token，调用时需要持有refreshMu
+func (m *TokenManager) fetchToken() error {
+	token, expiresIn, err := m.fetch(m.appId, m.appSecret)
+	if err != nil {
+		return err
+	}
+	if expiresIn <= 0 {
+		expiresIn = defaultExpires
+	}
+	m.mu.Lock()
+	m.token = token
+	m.expireAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	m.mu.Unlock()
+	log.Printf("access_token refreshed, expires in %ds\n", expiresIn)
+	return nil
+}
+
+// nextRefresh 距离下一次刷新的时间
+func (m *TokenManager) nextRefresh() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	wait := time.Until(m.expireAt.Add(-refreshAhead))
+	if wait < minBackoff {
+		wait = minBackoff
+	}
+	return wait
+}
+
+// loop 在access_token过期之前刷新，失败时指数退避重试
+func (m *TokenManager) loop() {
+	defer m.wg.Done()
+	backoff := minBackoff
+	timer := time.NewTimer(m.nextRefresh())
+	defer timer.Stop()
+	for {
+		select {
+		case <-m.quit:
+			return
+		case <-m.refresh:
+			// access_token已经被Invalidate刷新，按新的过期时间重新计时
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			backoff = minBackoff
+			timer.Reset(m.nextRefresh())
+			continue
+		case <-timer.C:
+		}
+		if err := m.update(); err != nil {
+			log.Printf("refresh access_token error: %v, retry in %s\n", err, backoff)
+			timer.Reset(backoff)
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = minBackoff
+		timer.Reset(m.nextRefresh())
+	}
+}
+
+// call 用access_token调用微信接口api，url中的 ACCESS_TOKEN 会被替换为当前的access_token。
+// body不为nil时以json格式post，否则发送get请求，成功时把响应反序列化到result中。
+// 微信返回错误时返回*APIError，access_token失效时强制刷新后重试一次
+func (m *TokenManager) call(api, url string, body, result interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	for retry := 0; ; retry++ {
+		token, err := m.Token()
+		if err != nil {
+			return err
+		}
+		res, err := httpCall(strings.Replace(url, "ACCESS_TOKEN", token, 1), data, body != nil)
+		if err != nil {
+			return err
+		}
+		err = parseResponse(api, res, result)
+		apiErr, ok := err.(*APIError)
+		if !ok || !apiErr.TokenInvalid() || retry > 0 {
+			return err
+		}
+		log.Printf("access_token is invalid (errcode %d), refresh it\n", apiErr.ErrCode)
+		if err = m.Invalidate(token); err != nil {
+			return err
+		}
+	}
+}
+
+// httpCall 发送http请求并读取响应
+func httpCall(url string, data []byte, post bool) ([]byte, error) {
+	var resp *http.Response
+	var err error
+	if post {
+		resp, err = httpClient.Post(url, "application/json;charset=UTF-8", bytes.NewReader(data))
+	} else {
+		resp, err = httpClient.Get(url)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// 调用微信接口的http客户端
+var httpClient = &http.Client{Timeout: 10 * time.Second}
@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 并发的Invalidate只刷新一次，否则每次刷新都会使其它goroutine刚拿到的access_token失效
+func TestInvalidateConcurrently(t *testing.T) {
+	var fetches int32
+	m := NewTokenManager("appid", "secret")
+	m.fetch = func(appId, appSecret string) (string, int, error) {
+		n := atomic.AddInt32(&fetches, 1)
+		time.Sleep(10 * time.Millisecond)
+		return "token" + strconv.Itoa(int(n)), 7200, nil
+	}
+	if err := m.update(); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.Invalidate("token1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Fatalf("access_token fetched %d times, want 2", n)
+	}
+	if token, _ := m.Token(); token != "token2" {
+		t.Fatalf("token = %s, want token2", token)
+	}
+	// 通知后台goroutine按新的过期时间重新计时
+	if len(m.refresh) != 1 {
+		t.Fatal("refresh timer not rescheduled")
+	}
+
+	// 已经被替换的token失效时不再刷新
+	if err := m.Invalidate("token1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Fatalf("stale token triggered a refresh, fetched %d times", n)
+	}
+}
@@ -1,13 +1,8 @@
 package manager
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"time"
 )
 
 // access_token 返回的数据结构类型
@@ -39,6 +34,16 @@ type TagName struct {
 	Name string `json:"name"`
 }
 
+// 客服消息的数据结构
+type CustomMessage struct {
+	ToUser  string      `json:"touser"`
+	MsgType string      `json:"msgtype"`
+	Text    *CustomText `json:"text,omitempty"`
+}
+type CustomText struct {
+	Content string `json:"content"`
+}
+
 // 获取公众号已创建的标签的数据结构
 type FindTagName struct {
 	Tags []TagMsg `json:"tags"`
@@ -50,118 +55,86 @@ type TagMsg struct {
 }
 
 // 1.获取到公众号的access_token 注：access_token有效期为2小时，access_token是调用微信端api的唯一识别码。
+// 一般不直接调用，由TokenManager获取和刷新
 func GetAccessToken(appId, appSecret string) (string, error) {
+	token, _, err := fetchAccessToken(appId, appSecret)
+	return token, err
+}
+
+// fetchAccessToken 获取access_token和有效期(秒)
+func fetchAccessToken(appId, appSecret string) (string, int, error) {
 	Url := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/token?grant_type=client_credential&appid=%s&secret=%s", appId, appSecret)
-	resp, err := http.Get(Url)
+	byteGet, err := httpCall(Url, nil, false)
 	if err != nil {
 		log.Println("get access_token error:", err)
-		return "", err
-	}
-	byteGet, err := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	if err != nil {
-		log.Println("ioutil reader error:", err)
-		return "", err
+		return "", 0, err
 	}
 	token := &AccToken{}
-	json.Unmarshal(byteGet, token)
-
-	return token.Token, nil
+	if err = parseResponse("token", byteGet, token); err != nil {
+		return "", 0, err
+	}
+	if token.Token == "" {
+		return "", 0, fmt.Errorf("wechat api token returned empty access_token")
+	}
+	return token.Token, token.LimitTime, nil
 }
 
 // 2.创建一个标签,name为创建标签的名字。并返回创建标签的id, 每个标签只能创建一次。
-func CreateTag(accessToken, name string) (int, error) {
-	Url := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/tags/create?access_token=%s", accessToken)
+func CreateTag(tokens *TokenManager, name string) (int, error) {
 	// 请求数据处理
 	marshalData := &MarshalTag{
 		Tag: &TagName{
 			Name: name,
 		},
 	}
-	data, err := json.Marshal(marshalData)
+	// 反序列化
+	tag := &UnmarshalTag{}
+	err := tokens.call("tags/create", "https://api.weixin.qq.com/cgi-bin/tags/create?access_token=ACCESS_TOKEN", marshalData, tag)
 	if err != nil {
-		log.Println("marshal error:", err)
 		return 0, err
 	}
-	reader := bytes.NewReader(data)
-	resp, err := http.Post(Url, "application/json;charset=UTF-8", reader)
-	if err != nil {
-		log.Println("post error:", err)
-		return 0, err
+	if tag.Tag == nil {
+		return 0, fmt.Errorf("wechat api tags/create returned no tag")
 	}
-	res, _ := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	// 反序列化
-	tag := &UnmarshalTag{Tag: &TagParam{}}
-	json.Unmarshal(res, tag)
-
-	fmt.Printf("创建标签返回的 id=%d name=%s\n", tag.Tag.Id, tag.Tag.Name) // 调试用
+	log.Printf("created tag %s, id=%d\n", tag.Tag.Name, tag.Tag.Id)
 	return tag.Tag.Id, nil
 }
 
-// 3.为申请打币的用户添加进 id = "开发者"标签 的分组，accessToken为access_token，openIds为用户的open id集合，id 为标签id，由微信分配
-func AddTagForUser(accessToken string, openIds []string, id int) error {
-	Url := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/tags/members/batchtagging?access_token=%s", accessToken)
+// 3.为申请打币的用户添加进 id = "开发者"标签 的分组，openIds为用户的open id集合，最多50个，id 为标签id，由微信分配
+func AddTagForUser(tokens *TokenManager, openIds []string, id int) error {
+	if len(openIds) == 0 || len(openIds) > MaxTagBatch {
+		return fmt.Errorf("batch tagging needs 1 to %d openids, got %d", MaxTagBatch, len(openIds))
+	}
 	// 请求的数据
 	playtag := &PlayTag{
 		OpenidList: openIds,
 		Tagid:      id,
 	}
-	byteData, err := json.Marshal(playtag)
-	if err != nil {
-		log.Println("json marshal play tag error:", err)
-		return err
-	}
-	reader := bytes.NewReader(byteData)
-	resp, err := http.Post(Url, "application/json;charset=UTF-8", reader)
-	if err != nil {
-		log.Println("play tag post error:", err)
-		return err
-	}
-
-	// 调试用,打印出响应的数据，打印出 {"errcode":0,"errmsg":"ok"} 则表示操作成功
-	res, _ := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	fmt.Println("批量为用户打标签post响应数据：", string(res))
-
-	return nil
+	return tokens.call("tags/members/batchtagging", "https://api.weixin.qq.com/cgi-bin/tags/members/batchtagging?access_token=ACCESS_TOKEN", playtag, nil)
 }
 
-// 4.定时器函数，定时每2小时更新access_token,AccessToken为更新到的全局变量
-func Timer(appId, appSecret, AccessToken string) {
-	tick := time.NewTicker(7140 * time.Second) // 提前1分钟进行更新
-	for {
-		select {
-		case <-tick.C:
-			var err error
-			AccessToken, err = GetAccessToken(appId, appSecret)
-			if err != nil {
-				log.Println("get access_token error:", err)
-				return
-			}
-			fmt.Println("定时更新后的access_token:", AccessToken) // 调试用
-		}
-	}
-}
-
-// 5.查找公众号已创建的标签中是否存在给定name的标签,如果存在则返回标签对应的tagid,如果不存在则返回0
-func FindTagToName(AccessToken, name string) int {
-	url := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/tags/get?access_token=%s", AccessToken)
-	resp, err := http.Get(url)
+// 4.查找公众号已创建的标签中是否存在给定name的标签,如果存在则返回标签对应的tagid,如果不存在则返回0
+func FindTagToName(tokens *TokenManager, name string) (int, error) {
+	tags, err := ListTags(tokens)
 	if err != nil {
-		log.Println("获取公众号已创建的标签失败:", err)
+		return 0, err
 	}
-	res, _ := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	// 反序列化得到findTagName的结构体
-	findTagName := &FindTagName{Tags: []TagMsg{}}
-	json.Unmarshal(res, findTagName)
 
 	// 找出是否有名字为name的tag
-	for i := 0; i < len(findTagName.Tags); i++ {
-		if findTagName.Tags[i].Name == name {
-			return findTagName.Tags[i].Id
+	for i := 0; i < len(tags); i++ {
+		if tags[i].Name == name {
+			return tags[i].Id, nil
 		}
 	}
-	return 0
+	return 0, nil
+}
+
+// 5.通过客服消息接口给用户发送文本消息，用户48小时内和公众号有过互动才能发送成功
+func SendCustomText(tokens *TokenManager, openId, content string) error {
+	msg := &CustomMessage{
+		ToUser:  openId,
+		MsgType: "text",
+		Text:    &CustomText{Content: content},
+	}
+	return tokens.call("message/custom/send", "https://api.weixin.qq.com/cgi-bin/message/custom/send?access_token=ACCESS_TOKEN", msg, nil)
 }
@@ -0,0 +1,152 @@
+package payout
+
+import (
+	"github.com/lemoTestCoin/store"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	trackInterval = 15 * time.Second // 多久查询一次等待确认的交易
+	expireGrace   = time.Minute      // 交易过期之后再等待一段时间，避免节点之间的时间误差
+	lookupRetries = 4                // 交易过期后连续查询失败多少次放弃此申请
+)
+
+// TxStatus 节点中交易的状态
+type TxStatus int
+
+const (
+	TxNotFound  TxStatus = iota // 节点中没有此交易
+	TxPending                   // 交易在交易池中
+	TxConfirmed                 // 交易已经打包进区块
+)
+
+// TxLookup 根据交易hash查询交易状态
+type TxLookup func(txHash string) (TxStatus, error)
+
+// Tracker 轮询等待确认的交易，更新申请状态，过期的交易重新加入打币队列重发一次
+type Tracker struct {
+	db     *store.Store
+	lookup TxLookup
+	worker *Worker // 重发时唤醒worker
+	notify Notifier
+
+	failures map[uint64]int // 申请id -> 连续查询交易失败的次数，只在loop中访问
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewTracker 创建交易确认的tracker，notify可以为nil
+func NewTracker(db *store.Store, lookup TxLookup, worker *Worker, notify Notifier) *Tracker {
+	return &Tracker{
+		db:     db,
+		lookup: lookup,
+		worker: worker,
+		notify: notify,
+
+		failures: make(map[uint64]int),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start 启动后台goroutine
+func (t *Tracker) Start() {
+	t.wg.Add(1)
+	go t.loop()
+}
+
+// Stop 停止轮询
+func (t *Tracker) Stop() {
+	close(t.quit)
+	t.wg.Wait()
+}
+
+func (t *Tracker) loop() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(trackInterval)
+	defer ticker.Stop()
+	for {
+		t.check()
+		select {
+		case <-t.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check 查询所有等待确认的交易
+func (t *Tracker) check() {
+	records, err := t.db.PendingClaims()
+	if err != nil {
+		log.Println("payout: read pending claims error:", err)
+		return
+	}
+	for _, record := range records {
+		t.track(record)
+	}
+}
+
+func (t *Tracker) track(record *store.ClaimRecord) {
+	expired := !time.Now().Before(time.Unix(record.Expiration, 0).Add(expireGrace))
+	status, err := t.lookup(record.TxHash)
+	if err != nil {
+		log.Printf("payout: lookup tx %s error: %v\n", record.TxHash, err)
+		t.failures[record.ID]++
+		// 节点一直不可用时交易过期后放弃，不知道交易是否已经上链，不能重发
+		if expired && t.failures[record.ID] >= lookupRetries {
+			t.abandon(record, "transaction "+record.TxHash+" expired, status unknown: "+err.Error())
+		}
+		return
+	}
+	delete(t.failures, record.ID)
+	if status == TxConfirmed {
+		if err = t.db.Confirm(record.ID); err != nil {
+			log.Printf("payout: confirm claim %d error: %v\n", record.ID, err)
+			return
+		}
+		record.Status = store.StatusConfirmed
+		t.done(record)
+		return
+	}
+	// 交易还没有过期，继续等待
+	if !expired {
+		return
+	}
+	reason := "transaction " + record.TxHash + " expired"
+	if record.Attempts < maxAttempts {
+		log.Printf("payout: %s, requeue claim %d\n", reason, record.ID)
+		if err = t.db.Requeue(record.ID, reason); err != nil {
+			log.Printf("payout: requeue claim %d error: %v\n", record.ID, err)
+			return
+		}
+		t.worker.Wake()
+		return
+	}
+	if err = t.db.Expire(record.ID, reason); err != nil {
+		log.Printf("payout: expire claim %d error: %v\n", record.ID, err)
+		return
+	}
+	record.Status, record.Error = store.StatusExpired, reason
+	t.done(record)
+}
+
+// abandon 放弃无法确认状态的申请，不退回发放额度和申请间隔
+func (t *Tracker) abandon(record *store.ClaimRecord, reason string) {
+	log.Printf("payout: %s, abandon claim %d\n", reason, record.ID)
+	abandoned, err := t.db.AbandonPending(record.ID, reason)
+	if err != nil {
+		log.Printf("payout: abandon claim %d error: %v\n", record.ID, err)
+		return
+	}
+	delete(t.failures, record.ID)
+	t.done(abandoned)
+}
+
+func (t *Tracker) done(record *store.ClaimRecord) {
+	if t.notify != nil {
+		t.notify(record)
+	}
+}
@@ -0,0 +1,71 @@
+package payout
+
+import (
+	"errors"
+	"github.com/lemoTestCoin/store"
+	"testing"
+	"time"
+)
+
+// 节点一直不可用时，过期的交易在连续查询失败后放弃，不重发
+func TestTrackAbandonsExpiredClaimWhenLookupFails(t *testing.T) {
+	db := openStore(t)
+	claim, err := db.Reserve(testAddress, "user", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.MarkSending(claim.ID, time.Now().Add(-time.Hour).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Commit(claim.ID, "0x01"); err != nil {
+		t.Fatal(err)
+	}
+	var notified []*store.ClaimRecord
+	tracker := NewTracker(db, func(string) (TxStatus, error) {
+		return TxNotFound, errors.New("node unavailable")
+	}, nil, func(r *store.ClaimRecord) { notified = append(notified, r) })
+	for i := 0; i < lookupRetries; i++ {
+		tracker.check()
+	}
+
+	record, err := db.GetClaim(claim.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != store.StatusFailed {
+		t.Fatalf("status = %s, want %s", record.Status, store.StatusFailed)
+	}
+	if pending, _ := db.PendingClaims(); len(pending) != 0 {
+		t.Fatal("abandoned claim is still pending")
+	}
+	if queued, _ := db.QueuedClaims(1); len(queued) != 0 {
+		t.Fatal("abandoned claim was requeued")
+	}
+	if len(notified) != 1 {
+		t.Fatalf("notified %d times, want 1", len(notified))
+	}
+}
+
+// 交易没有过期时，查询失败继续等待
+func TestTrackKeepsUnexpiredClaimWhenLookupFails(t *testing.T) {
+	db := openStore(t)
+	claim, err := db.Reserve(testAddress, "user", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.MarkSending(claim.ID, time.Now().Add(time.Hour).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Commit(claim.ID, "0x01"); err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewTracker(db, func(string) (TxStatus, error) {
+		return TxNotFound, errors.New("node unavailable")
+	}, nil, nil)
+	for i := 0; i < lookupRetries*2; i++ {
+		tracker.check()
+	}
+	if pending, _ := db.PendingClaims(); len(pending) != 1 {
+		t.Fatal("unexpired claim should stay pending")
+	}
+}
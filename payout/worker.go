@@ -0,0 +1,200 @@
+// 后台打币，从store的打币队列中取出申请，签名并发送交易，然后通知申请人结果
+package payout
+
+import (
+	"github.com/lemoTestCoin/store"
+	"github.com/lemoTestCoin/types"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	pollInterval = 5 * time.Second  // 队列为空时，最长多久检查一次队列
+	txTimeToLive = 30 * time.Minute // 打币交易的有效期
+	maxAttempts  = 2                // 交易过期未上链时重发一次
+
+	commitAttempts   = 3           // 交易发送成功后记录结果的最多尝试次数
+	commitRetryDelay = time.Second // 记录结果失败后的等待时间，每次重试加倍
+)
+
+// Sender 发送打币交易，expiration为交易的过期时间，返回交易hash。
+// 交易签名之后发送失败时也要返回交易hash，节点明确拒绝交易时返回*types.RPCError
+type Sender func(address string, amount *big.Int, expiration time.Time) (string, error)
+
+// Notifier 申请处理完成(上链、过期或者失败)后的回调
+type Notifier func(record *store.ClaimRecord)
+
+// Worker 单个goroutine按顺序处理打币队列
+type Worker struct {
+	db     *store.Store
+	send   Sender
+	notify Notifier
+
+	wake chan struct{}
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewWorker 创建打币worker，notify可以为nil
+func NewWorker(db *store.Store, send Sender, notify Notifier) *Worker {
+	return &Worker{
+		db:     db,
+		send:   send,
+		notify: notify,
+		wake:   make(chan struct{}, 1),
+		quit:   make(chan struct{}),
+	}
+}
+
+// Start 恢复上次退出时中断的申请，然后启动后台goroutine
+func (w *Worker) Start() error {
+	interrupted, err := w.db.RecoverQueue()
+	if err != nil {
+		return err
+	}
+	for _, record := range interrupted {
+		log.Printf("payout: claim %d for %s was interrupted while sending\n", record.ID, record.Address)
+		w.done(record)
+	}
+	w.wg.Add(1)
+	go w.loop()
+	return nil
+}
+
+// Stop 等待正在处理的申请完成后退出
+func (w *Worker) Stop() {
+	close(w.quit)
+	w.wg.Wait()
+}
+
+// Wake 有新的申请加入队列时调用，立即处理队列
+func (w *Worker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Worker) loop() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		w.processQueue()
+		select {
+		case <-w.quit:
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processQueue 处理队列中所有的申请
+func (w *Worker) processQueue() {
+	for {
+		select {
+		case <-w.quit:
+			return
+		default:
+		}
+		// 暂停打币时申请留在队列中，恢复后由Wake继续处理
+		state, err := w.db.PauseState()
+		if err != nil {
+			log.Println("payout: read pause state error:", err)
+			return
+		}
+		if state.Paused {
+			return
+		}
+		records, err := w.db.QueuedClaims(1)
+		if err != nil {
+			log.Println("payout: read queue error:", err)
+			return
+		}
+		if len(records) == 0 {
+			return
+		}
+		// db出错时等待下一次检查队列，避免反复处理同一条申请
+		if !w.process(records[0]) {
+			return
+		}
+	}
+}
+
+// process 检查黑名单后发送一笔打币交易，成功则Commit等待确认，节点拒绝交易则Release。
+// 返回false表示db出错，申请仍在队列中
+func (w *Worker) process(record *store.ClaimRecord) bool {
+	// 队列中处于发送中的申请已经发送过交易但没有记录结果，不能再次发送
+	if record.Status == store.StatusSending {
+		return w.abandon(record, "", "send result unknown")
+	}
+	amount, ok := new(big.Int).SetString(record.Amount, 10)
+	if !ok {
+		return w.release(record, "invalid amount "+record.Amount)
+	}
+	// 申请加入队列之后才被拉黑的地址、用户和ip，在发送交易之前拒绝
+	if err := w.db.CheckBlacklist(record, time.Now()); err != nil {
+		log.Printf("payout: reject claim %d: %v\n", record.ID, err)
+		return w.release(record, err.Error())
+	}
+	expiration := time.Now().Add(txTimeToLive)
+	if err := w.db.MarkSending(record.ID, expiration.Unix()); err != nil {
+		log.Printf("payout: mark claim %d sending error: %v\n", record.ID, err)
+		return w.release(record, "mark sending error: "+err.Error())
+	}
+	txHash, err := w.send(record.Address, amount, expiration)
+	if err != nil {
+		log.Printf("payout: send coin to %s error: %v\n", record.Address, err)
+		// 只有节点明确拒绝或者交易还没有签名时才能确定交易没有发出。
+		// 超时、连接断开时节点可能已经收到了交易，不能退回申请间隔和发放额度，按已发送处理由Tracker确认，
+		// 交易过期后仍查不到时Tracker才会重发
+		if _, rejected := err.(*types.RPCError); rejected || txHash == "" {
+			return w.release(record, err.Error())
+		}
+		log.Printf("payout: send result of claim %d unknown, track tx %s\n", record.ID, txHash)
+	}
+	// 交易可能已经发出，必须记录结果，否则申请会留在队列中。交易是否上链由Tracker确认
+	for i := 1; ; i++ {
+		if err = w.db.Commit(record.ID, txHash); err == nil {
+			return true
+		}
+		log.Printf("payout: commit claim %d error (attempt %d): %v\n", record.ID, i, err)
+		if i == commitAttempts {
+			break
+		}
+		time.Sleep(commitRetryDelay << uint(i-1))
+	}
+	return w.abandon(record, txHash, "commit error: "+err.Error())
+}
+
+// release 交易没有发出，释放申请并通知申请人
+func (w *Worker) release(record *store.ClaimRecord, reason string) bool {
+	if err := w.db.Release(record.ID, reason); err != nil {
+		log.Printf("payout: release claim %d error: %v\n", record.ID, err)
+		return false
+	}
+	record.Status, record.Error = store.StatusFailed, reason
+	w.done(record)
+	return true
+}
+
+// abandon 交易可能已经发出但无法记录结果，标记为失败并移出队列，不退回申请间隔和发放额度
+func (w *Worker) abandon(record *store.ClaimRecord, txHash, reason string) bool {
+	abandoned, err := w.db.Abandon(record.ID, txHash, reason)
+	if err != nil {
+		log.Printf("payout: abandon claim %d error: %v\n", record.ID, err)
+		return false
+	}
+	log.Printf("payout: claim %d for %s abandoned, tx %s: %s\n", record.ID, record.Address, txHash, reason)
+	w.done(abandoned)
+	return true
+}
+
+func (w *Worker) done(record *store.ClaimRecord) {
+	if w.notify != nil {
+		w.notify(record)
+	}
+}
@@ -0,0 +1,119 @@
+package payout
+
+import (
+	"errors"
+	"github.com/lemoTestCoin/store"
+	"github.com/lemoTestCoin/types"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testAddress = "Lemo83W7HDZYS33Z745NZ2FGF37565DSF5AHJZ4J"
+
+func openStore(t *testing.T) *store.Store {
+	db, err := store.Open(filepath.Join(t.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetPolicy(store.Policy{Amount: "10", AddressInterval: time.Hour})
+	return db
+}
+
+// 发送中的申请已经发过交易，不能再次发送
+func TestProcessQueueSkipsSendingClaim(t *testing.T) {
+	db := openStore(t)
+	claim, err := db.Reserve(testAddress, "user", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.MarkSending(claim.ID, time.Now().Add(txTimeToLive).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	sent := 0
+	var notified []*store.ClaimRecord
+	w := NewWorker(db, func(string, *big.Int, time.Time) (string, error) {
+		sent++
+		return "0x01", nil
+	}, func(r *store.ClaimRecord) { notified = append(notified, r) })
+	w.processQueue()
+
+	if sent != 0 {
+		t.Fatalf("sending claim was sent again %d times", sent)
+	}
+	record, err := db.GetClaim(claim.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != store.StatusFailed {
+		t.Fatalf("status = %s, want %s", record.Status, store.StatusFailed)
+	}
+	if queued, _ := db.QueuedClaims(1); len(queued) != 0 {
+		t.Fatal("abandoned claim is still queued")
+	}
+	if len(notified) != 1 {
+		t.Fatalf("notified %d times, want 1", len(notified))
+	}
+	// 不退回申请间隔
+	if _, err = db.Reserve(testAddress, "user", time.Now()); err == nil {
+		t.Fatal("abandoned claim should keep the address cooldown")
+	}
+}
+
+// 节点明确拒绝的交易没有发出，释放申请
+func TestProcessQueueReleasesRejectedSend(t *testing.T) {
+	db := openStore(t)
+	claim, err := db.Reserve(testAddress, "user", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := &types.RPCError{Code: -32000, Message: "insufficient balance"}
+	w := NewWorker(db, func(string, *big.Int, time.Time) (string, error) {
+		return "0x01", rejected
+	}, nil)
+	w.processQueue()
+
+	record, err := db.GetClaim(claim.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != store.StatusFailed || record.Error != rejected.Error() {
+		t.Fatalf("got status %s error %q", record.Status, record.Error)
+	}
+	if _, err = db.Reserve(testAddress, "user", time.Now()); err != nil {
+		t.Fatal("released claim should restore the address cooldown:", err)
+	}
+}
+
+// 超时等错误时节点可能已经收到交易，不释放申请，按本地计算的交易hash等待确认
+func TestProcessQueueTracksUnknownSend(t *testing.T) {
+	db := openStore(t)
+	claim, err := db.Reserve(testAddress, "user", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	notified := 0
+	w := NewWorker(db, func(string, *big.Int, time.Time) (string, error) {
+		return "0x01", errors.New("read tcp: i/o timeout")
+	}, func(*store.ClaimRecord) { notified++ })
+	w.processQueue()
+
+	record, err := db.GetClaim(claim.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != store.StatusPending || record.TxHash != "0x01" {
+		t.Fatalf("got status %s tx %q, want pending 0x01", record.Status, record.TxHash)
+	}
+	if pending, _ := db.PendingClaims(); len(pending) != 1 {
+		t.Fatal("claim should be tracked by the tracker")
+	}
+	if notified != 0 {
+		t.Fatalf("notified %d times before the tx is confirmed", notified)
+	}
+	if _, err = db.Reserve(testAddress, "user", time.Now()); err == nil {
+		t.Fatal("claim with unknown send result should keep the address cooldown")
+	}
+}
@@ -0,0 +1,156 @@
+// 工作量证明(hashcash)，用于没有微信身份的渠道(网页、http接口)防止脚本批量申请。
+// 服务端发出随机的题目和难度，客户端找到一个解使 keccak256(题目:解) 的前difficulty个bit为0，
+// 服务端验证后在store中把题目标记为已使用，每个题目只能使用一次。
+// 难度随最近按ip限制的渠道的申请量自动提高
+package pow
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"github.com/lemoTestCoin/common/crypto"
+	"github.com/lemoTestCoin/store"
+	"log"
+	"math/bits"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownChallenge = errors.New("unknown or used challenge")
+	ErrExpired          = errors.New("challenge expired")
+	ErrInvalidSolution  = errors.New("invalid solution")
+)
+
+// 最近的申请量缓存多久，避免每次发题目都统计申请
+const scaleCacheTime = 10 * time.Second
+
+// Challenge 发给客户端的题目
+type Challenge struct {
+	Nonce      string    `json:"nonce"`      // 发出时间加随机数的题目，同时作为题目的id
+	Difficulty int       `json:"difficulty"` // hash需要的前导0的bit数
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// Policy 题目的难度和有效期
+type Policy struct {
+	Difficulty    int           // 基础难度
+	MaxDifficulty int           // 自动提高后的最大难度
+	TTL           time.Duration // 题目的有效期
+	ScaleWindow   time.Duration // 统计最近多长时间内的申请量
+	ScaleClaims   uint64        // ScaleWindow内的申请数达到ScaleClaims时难度加1，之后申请数每翻一倍再加1，0表示不自动提高
+}
+
+// Hash 计算 keccak256(nonce:solution)，与链上使用的hash相同
+func Hash(nonce, solution string) []byte {
+	return crypto.Keccak256([]byte(nonce + ":" + solution))
+}
+
+// LeadingZeroBits hash的前导0的bit数
+func LeadingZeroBits(hash []byte) int {
+	n := 0
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// Verify 检查solution是否是题目的解
+func Verify(nonce, solution string, difficulty int) bool {
+	return LeadingZeroBits(Hash(nonce, solution)) >= difficulty
+}
+
+// Solve 从0开始尝试找到题目的解，给命令行等Go客户端使用
+func Solve(nonce string, difficulty int) string {
+	for i := uint64(0); ; i++ {
+		solution := strconv.FormatUint(i, 10)
+		if Verify(nonce, solution, difficulty) {
+			return solution
+		}
+	}
+}
+
+// ScaledDifficulty 按最近的申请量计算难度
+func ScaledDifficulty(policy Policy, claims uint64) int {
+	difficulty := policy.Difficulty
+	if policy.ScaleClaims == 0 {
+		return difficulty
+	}
+	for n := policy.ScaleClaims; claims >= n && difficulty < policy.MaxDifficulty; n *= 2 {
+		difficulty++
+	}
+	return difficulty
+}
+
+// Issuer 发出题目和验证题目的解，题目保存在store中，可以被多个goroutine并发使用
+type Issuer struct {
+	db     *store.Store
+	policy Policy
+
+	mu        sync.Mutex
+	claims    uint64    // 最近ScaleWindow内的申请数
+	countedAt time.Time // 上次统计申请数的时间
+}
+
+// NewIssuer 创建题目的发放者
+func NewIssuer(db *store.Store, policy Policy) *Issuer {
+	return &Issuer{db: db, policy: policy}
+}
+
+// Difficulty 当前的难度和最近ScaleWindow内的申请数
+func (i *Issuer) Difficulty(now time.Time) (int, uint64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.policy.ScaleClaims > 0 && now.Sub(i.countedAt) > scaleCacheTime {
+		claims, err := i.db.CountIPClaims(now.Add(-i.policy.ScaleWindow))
+		if err != nil {
+			log.Println("pow: count recent claims error:", err)
+		} else {
+			i.claims, i.countedAt = claims, now
+		}
+	}
+	return ScaledDifficulty(i.policy, i.claims), i.claims
+}
+
+// Issue 发出一个新的题目。题目以发出时间开头，store中按发出时间排序，保存时顺便清理过期的题目
+func (i *Issuer) Issue(now time.Time) (*Challenge, error) {
+	nonce := make([]byte, 24)
+	binary.BigEndian.PutUint64(nonce, uint64(now.UnixNano()))
+	if _, err := rand.Read(nonce[8:]); err != nil {
+		return nil, err
+	}
+	difficulty, _ := i.Difficulty(now)
+	record := &store.ChallengeRecord{
+		Nonce:      hex.EncodeToString(nonce),
+		Difficulty: difficulty,
+		IssuedAt:   now,
+		ExpiresAt:  now.Add(i.policy.TTL),
+	}
+	if err := i.db.SaveChallenge(record, now); err != nil {
+		return nil, err
+	}
+	return &Challenge{Nonce: record.Nonce, Difficulty: record.Difficulty, ExpiresAt: record.ExpiresAt}, nil
+}
+
+// Redeem 验证题目的解，无论是否正确题目都会被标记为已使用，客户端需要重新获取题目
+func (i *Issuer) Redeem(nonce, solution string, now time.Time) error {
+	record, err := i.db.SpendChallenge(nonce, now)
+	if err == store.ErrNotFound || err == store.ErrChallengeSpent {
+		return ErrUnknownChallenge
+	}
+	if err != nil {
+		return err
+	}
+	if now.After(record.ExpiresAt) {
+		return ErrExpired
+	}
+	if !Verify(nonce, solution, record.Difficulty) {
+		return ErrInvalidSolution
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package pow
+
+import (
+	"github.com/lemoTestCoin/store"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		hash []byte
+		want int
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x10}, 11},
+		{[]byte{0x00, 0x00}, 16},
+	}
+	for _, test := range tests {
+		if got := LeadingZeroBits(test.hash); got != test.want {
+			t.Errorf("LeadingZeroBits(%x) = %d, want %d", test.hash, got, test.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const nonce, difficulty = "00112233445566778899aabbccddeeff", 12
+	solution := Solve(nonce, difficulty)
+	if !Verify(nonce, solution, difficulty) {
+		t.Fatalf("solution %s is not accepted", solution)
+	}
+	if LeadingZeroBits(Hash(nonce, solution)) < difficulty {
+		t.Fatalf("solution %s has less than %d leading zero bits", solution, difficulty)
+	}
+	// 找一个不满足难度的解
+	for i := 0; ; i++ {
+		wrong := solution + "x" + strconv.Itoa(i)
+		if LeadingZeroBits(Hash(nonce, wrong)) < difficulty {
+			if Verify(nonce, wrong, difficulty) {
+				t.Fatalf("wrong solution %s is accepted", wrong)
+			}
+			break
+		}
+	}
+	if Verify("another nonce", solution, 64) {
+		t.Fatal("solution of another nonce is accepted")
+	}
+}
+
+func TestScaledDifficulty(t *testing.T) {
+	policy := Policy{Difficulty: 16, MaxDifficulty: 19, ScaleClaims: 100}
+	tests := []struct {
+		claims uint64
+		want   int
+	}{
+		{0, 16},
+		{99, 16},
+		{100, 17},
+		{199, 17},
+		{200, 18},
+		{400, 19},
+		{100000, 19}, // 不超过最大难度
+	}
+	for _, test := range tests {
+		if got := ScaledDifficulty(policy, test.claims); got != test.want {
+			t.Errorf("ScaledDifficulty(%d claims) = %d, want %d", test.claims, got, test.want)
+		}
+	}
+	policy.ScaleClaims = 0
+	if got := ScaledDifficulty(policy, 100000); got != 16 {
+		t.Errorf("ScaledDifficulty without scaling = %d, want 16", got)
+	}
+}
+
+func newTestIssuer(t *testing.T) *Issuer {
+	db, err := store.Open(filepath.Join(t.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewIssuer(db, Policy{Difficulty: 8, MaxDifficulty: 8, TTL: time.Minute})
+}
+
+// 每个题目只能使用一次，并发提交时只有一个能成功
+func TestRedeemOnce(t *testing.T) {
+	issuer := newTestIssuer(t)
+	now := time.Now()
+	challenge, err := issuer.Issue(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	solution := Solve(challenge.Nonce, challenge.Difficulty)
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		ok int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if issuer.Redeem(challenge.Nonce, solution, now) == nil {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if ok != 1 {
+		t.Fatalf("%d concurrent redeems succeeded, want 1", ok)
+	}
+	if err = issuer.Redeem(challenge.Nonce, solution, now); err != ErrUnknownChallenge {
+		t.Fatalf("redeem spent challenge returned %v, want %v", err, ErrUnknownChallenge)
+	}
+}
+
+// 错误的解也会用掉题目
+func TestRedeemInvalidSolution(t *testing.T) {
+	issuer := newTestIssuer(t)
+	now := time.Now()
+	challenge, err := issuer.Issue(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	solution := Solve(challenge.Nonce, challenge.Difficulty)
+	wrong := solution
+	for i := 0; Verify(challenge.Nonce, wrong, challenge.Difficulty); i++ {
+		wrong = solution + "x" + strconv.Itoa(i)
+	}
+	if err = issuer.Redeem(challenge.Nonce, wrong, now); err != ErrInvalidSolution {
+		t.Fatalf("redeem wrong solution returned %v, want %v", err, ErrInvalidSolution)
+	}
+	if err = issuer.Redeem(challenge.Nonce, solution, now); err != ErrUnknownChallenge {
+		t.Fatalf("redeem after a wrong solution returned %v, want %v", err, ErrUnknownChallenge)
+	}
+}
+
+func TestRedeemExpired(t *testing.T) {
+	issuer := newTestIssuer(t)
+	now := time.Now()
+	challenge, err := issuer.Issue(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	solution := Solve(challenge.Nonce, challenge.Difficulty)
+	if err = issuer.Redeem(challenge.Nonce, solution, now.Add(2*time.Minute)); err != ErrExpired {
+		t.Fatalf("redeem expired challenge returned %v, want %v", err, ErrExpired)
+	}
+	if err = issuer.Redeem("unknown", solution, now); err != ErrUnknownChallenge {
+		t.Fatalf("redeem unknown challenge returned %v, want %v", err, ErrUnknownChallenge)
+	}
+}
+
+// 发新题目时删除已经过期的题目，没有过期的题目保留
+func TestIssuePrunesExpired(t *testing.T) {
+	issuer := newTestIssuer(t)
+	start := time.Now()
+	old, err := issuer.Issue(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent, err := issuer.Issue(start.Add(30 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := start.Add(90 * time.Second)
+	if _, err = issuer.Issue(now); err != nil {
+		t.Fatal(err)
+	}
+	if err = issuer.Redeem(old.Nonce, Solve(old.Nonce, old.Difficulty), now); err != ErrUnknownChallenge {
+		t.Fatalf("redeem pruned challenge returned %v, want %v", err, ErrUnknownChallenge)
+	}
+	if err = issuer.Redeem(recent.Nonce, Solve(recent.Nonce, recent.Difficulty), now); err != nil {
+		t.Fatalf("redeem unexpired challenge: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+// 运维操作: 暂停打币、查询申请记录、重置申请间隔和手动打币
+
+var ErrPaused = errors.New("faucet payouts are paused")
+
+// meta表中暂停打币的状态，value = PauseState
+var pauseKey = []byte("pause")
+
+// PauseState 暂停打币的状态，暂停时不接受新的申请，队列中的申请等恢复后再发送
+type PauseState struct {
+	Paused    bool      `json:"paused"`
+	Reason    string    `json:"reason,omitempty"`
+	By        string    `json:"by,omitempty"` // 操作人
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SetPaused 暂停或者恢复打币
+func (s *Store) SetPaused(paused bool, reason, by string, now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(metaBucket), pauseKey, &PauseState{Paused: paused, Reason: reason, By: by, UpdatedAt: now})
+	})
+}
+
+// PauseState 获取暂停打币的状态，没有暂停过时返回未暂停
+func (s *Store) PauseState() (*PauseState, error) {
+	var state *PauseState
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		state, err = pauseState(tx)
+		return err
+	})
+	return state, err
+}
+
+func pauseState(tx *bolt.Tx) (*PauseState, error) {
+	state := new(PauseState)
+	if err := getJSON(tx.Bucket(metaBucket), pauseKey, state); err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	return state, nil
+}
+
+// ClaimHistory 按时间从新到旧返回地址、微信用户或ip最近的limit条申请，包括失败的申请
+func (s *Store) ClaimHistory(target, value string, limit int) ([]*ClaimRecord, error) {
+	var match func(*ClaimRecord) bool
+	switch target {
+	case TargetAddress:
+		value = normalizeAddress(value)
+		match = func(r *ClaimRecord) bool { return r.Address == value }
+	case TargetOpenID:
+		match = func(r *ClaimRecord) bool { return r.OpenID == value }
+	case TargetIP:
+		match = func(r *ClaimRecord) bool { return r.IP == value }
+	default:
+		return nil, fmt.Errorf("unknown claim target %q", target)
+	}
+	var records []*ClaimRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(claimBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(records) < limit; k, v = c.Prev() {
+			record := new(ClaimRecord)
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+			if match(record) {
+				records = append(records, record)
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// ResetCooldown 清除地址、微信用户或ip的申请间隔和当天的申请次数，使其可以立即再次申请。
+// 记录重置的时间，之后释放的申请不会恢复重置之前的申请间隔。不修改申请记录和发放额度，没有申请过返回ErrNotFound
+func (s *Store) ResetCooldown(target, value string) error {
+	now := time.Now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		switch target {
+		case TargetAddress:
+			addresses := tx.Bucket(addressBucket)
+			key := []byte(normalizeAddress(value))
+			addr := new(AddressRecord)
+			if err := getJSON(addresses, key, addr); err != nil {
+				return err
+			}
+			addr.LastClaimAt, addr.ResetAt = time.Time{}, now
+			return putJSON(addresses, key, addr)
+		case TargetOpenID:
+			users := tx.Bucket(userBucket)
+			user := new(UserRecord)
+			if err := getJSON(users, []byte(value), user); err != nil {
+				return err
+			}
+			user.LastClaimAt, user.DayClaims, user.ResetAt = time.Time{}, 0, now
+			return putJSON(users, []byte(value), user)
+		case TargetIP:
+			ips := tx.Bucket(ipBucket)
+			last := new(IPRecord)
+			if err := getJSON(ips, []byte(value), last); err != nil {
+				return err
+			}
+			last.LastClaimAt, last.DayClaims, last.ResetAt = time.Time{}, 0, now
+			return putJSON(ips, []byte(value), last)
+		default:
+			return fmt.Errorf("unknown cooldown target %q", target)
+		}
+	})
+}
+
+// ReserveManual 运维手动给地址打币，不检查暂停状态、名单、申请限制和发放上限，但仍计入发放额度和地址的申请记录
+func (s *Store) ReserveManual(address, by string, now time.Time) (*ClaimRecord, error) {
+	return s.reserve(&ClaimRecord{Address: address, Channel: ChannelAdmin, Operator: by}, now, true)
+}
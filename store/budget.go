@@ -0,0 +1,99 @@
+package store
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	"math/big"
+	"time"
+)
+
+// 发放测试币总量的统计，key = hour:2006010215 或 day:20060102，value = 十进制的数量(单位mo)
+var budgetBucket = []byte("budget")
+
+// BudgetError 当前小时或者当天发放的测试币已经达到上限
+type BudgetError struct {
+	ResetAt time.Time // 额度恢复的时间
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("faucet budget exhausted until %s", e.ResetAt.Format("2006-01-02 15:04"))
+}
+
+// BudgetUsage 当前小时和当天已经发放的测试币和上限，上限为nil表示不限制
+type BudgetUsage struct {
+	Hour      string   `json:"hour"`
+	HourSpent *big.Int `json:"hourSpent"`
+	HourlyCap *big.Int `json:"hourlyCap"`
+	Day       string   `json:"day"`
+	DaySpent  *big.Int `json:"daySpent"`
+	DailyCap  *big.Int `json:"dailyCap"`
+}
+
+func hourKey(t time.Time) []byte {
+	return []byte("hour:" + t.Local().Format("2006010215"))
+}
+
+func dayKey(t time.Time) []byte {
+	return []byte("day:" + t.Local().Format("20060102"))
+}
+
+// getAmount 读取统计的数量，不存在时为0
+func getAmount(b *bolt.Bucket, key []byte) *big.Int {
+	amount, ok := new(big.Int).SetString(string(b.Get(key)), 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return amount
+}
+
+// addBudget 在统计中加上amount(可以为负数)
+func addBudget(tx *bolt.Tx, t time.Time, amount *big.Int) error {
+	b := tx.Bucket(budgetBucket)
+	for _, key := range [][]byte{hourKey(t), dayKey(t)} {
+		total := getAmount(b, key).Add(getAmount(b, key), amount)
+		if total.Sign() < 0 {
+			total.SetInt64(0)
+		}
+		if err := b.Put(key, []byte(total.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBudget 检查加上amount之后是否会超过每小时和每天的上限
+func (s *Store) checkBudget(tx *bolt.Tx, now time.Time, amount *big.Int) error {
+	b := tx.Bucket(budgetBucket)
+	local := now.Local()
+	if limit := s.policy.DailyCap; limit != nil {
+		if new(big.Int).Add(getAmount(b, dayKey(now)), amount).Cmp(limit) > 0 {
+			return &BudgetError{ResetAt: time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, local.Location())}
+		}
+	}
+	if limit := s.policy.HourlyCap; limit != nil {
+		if new(big.Int).Add(getAmount(b, hourKey(now)), amount).Cmp(limit) > 0 {
+			return &BudgetError{ResetAt: local.Truncate(time.Hour).Add(time.Hour)}
+		}
+	}
+	return nil
+}
+
+// BudgetUsage 返回now所在小时和当天的发放统计
+func (s *Store) BudgetUsage(now time.Time) (*BudgetUsage, error) {
+	usage := &BudgetUsage{
+		Hour:      now.Local().Format("2006-01-02 15:00"),
+		HourlyCap: s.policy.HourlyCap,
+		Day:       now.Local().Format("2006-01-02"),
+		DailyCap:  s.policy.DailyCap,
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(budgetBucket)
+		usage.HourSpent = getAmount(b, hourKey(now))
+		usage.DaySpent = getAmount(b, dayKey(now))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+// 发出的工作量证明题目，key = 题目nonce, value = ChallengeRecord，过期后删除。
+// nonce以发出时间开头，key的顺序就是发出的顺序
+var challengeBucket = []byte("challenges")
+
+var ErrChallengeSpent = errors.New("challenge already spent")
+
+// ChallengeRecord 一个工作量证明的题目
+type ChallengeRecord struct {
+	Nonce      string    `json:"nonce"`
+	Difficulty int       `json:"difficulty"`
+	IssuedAt   time.Time `json:"issuedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Spent      bool      `json:"spent"`
+	SpentAt    time.Time `json:"spentAt"`
+}
+
+// SaveChallenge 记录发出的题目，并在同一个事务中从最早发出的题目开始删除已经过期的题目，
+// 每次只遍历过期的题目，不会随着题目的数量变慢
+func (s *Store) SaveChallenge(record *ChallengeRecord, now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		challenges := tx.Bucket(challengeBucket)
+		var expired [][]byte
+		c := challenges.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			old := new(ChallengeRecord)
+			if err := json.Unmarshal(v, old); err != nil {
+				return err
+			}
+			if !now.After(old.ExpiresAt) {
+				break
+			}
+			expired = append(expired, append([]byte{}, k...))
+		}
+		for _, k := range expired {
+			if err := challenges.Delete(k); err != nil {
+				return err
+			}
+		}
+		return putJSON(challenges, []byte(record.Nonce), record)
+	})
+}
+
+// SpendChallenge 把题目标记为已使用并返回题目，不存在返回ErrNotFound，已经使用过返回ErrChallengeSpent。
+// 同一个题目并发提交时只有一个能成功
+func (s *Store) SpendChallenge(nonce string, now time.Time) (*ChallengeRecord, error) {
+	record := new(ChallengeRecord)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		challenges := tx.Bucket(challengeBucket)
+		if err := getJSON(challenges, []byte(nonce), record); err != nil {
+			return err
+		}
+		if record.Spent {
+			return ErrChallengeSpent
+		}
+		record.Spent = true
+		record.SpentAt = now
+		return putJSON(challenges, []byte(nonce), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// PruneChallenges 遍历所有的题目删除已经过期的题目，过期的题目无论是否使用过都不能再提交。
+// 启动时调用一次，清理没有按发出时间排序的旧题目
+func (s *Store) PruneChallenges(now time.Time) (int, error) {
+	pruned := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		challenges := tx.Bucket(challengeBucket)
+		var expired [][]byte
+		err := challenges.ForEach(func(k, _ []byte) error {
+			record := new(ChallengeRecord)
+			if err := getJSON(challenges, k, record); err != nil {
+				return err
+			}
+			if now.After(record.ExpiresAt) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := challenges.Delete(k); err != nil {
+				return err
+			}
+		}
+		pruned = len(expired)
+		return nil
+	})
+	return pruned, err
+}
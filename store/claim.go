@@ -0,0 +1,189 @@
+package store
+
+import (
+	"encoding/json"
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+// ClaimStatus 申请测试币的状态
+type ClaimStatus string
+
+const (
+	StatusQueued    ClaimStatus = "queued"    // 已经通过申请限制检查，在打币队列中等待发送
+	StatusSending   ClaimStatus = "sending"   // 正在发送交易
+	StatusPending   ClaimStatus = "pending"   // 交易已经发送给节点，等待上链
+	StatusConfirmed ClaimStatus = "confirmed" // 交易已经上链
+	StatusExpired   ClaimStatus = "expired"   // 交易过期仍未上链，并且已经重发过
+	StatusFailed    ClaimStatus = "failed"    // 交易发送失败
+)
+
+// 申请的渠道
+const (
+	ChannelWeChat = "wechat" // 微信公众号
+	ChannelAPI    = "api"    // http json接口
+	ChannelWeb    = "web"    // 网页
+	ChannelAdmin  = "admin"  // 运维手动打币
+)
+
+// ClaimRecord 一次申请测试币的记录
+type ClaimRecord struct {
+	ID         uint64      `json:"id"`
+	Address    string      `json:"address"`
+	OpenID     string      `json:"openid,omitempty"`    // 通过微信申请时为用户的openid
+	IP         string      `json:"ip,omitempty"`        // 通过http接口申请时为客户端的ip
+	Channel    string      `json:"channel,omitempty"`   // 申请的渠道，见ChannelWeChat等
+	Scene      string      `json:"scene,omitempty"`     // 用户最近一次扫码的二维码场景值，即申请来自的推广渠道
+	Operator   string      `json:"operator,omitempty"`  // 运维手动打币时为操作人
+	Whitelist  string      `json:"whitelist,omitempty"` // 按白名单放宽限制时为生效的条目，格式为 类型:值
+	Amount     string      `json:"amount"`              // 打币数量，单位为mo
+	TxHash     string      `json:"txHash,omitempty"`
+	Status     ClaimStatus `json:"status"`
+	Error      string      `json:"error,omitempty"`      // 失败原因
+	Attempts   int         `json:"attempts"`             // 发送交易的次数，过期的交易会重发一次
+	Expiration int64       `json:"expiration,omitempty"` // 最近一次发送的交易的过期时间
+	CreatedAt  time.Time   `json:"createdAt"`
+	UpdatedAt  time.Time   `json:"updatedAt"`
+}
+
+// AddressRecord 一个Lemo地址最近一次成功的申请。Prev为最近一次之前的申请，最近的申请被释放时恢复为Prev
+type AddressRecord struct {
+	Address     string    `json:"address"`
+	LastClaimID uint64    `json:"lastClaimId"`
+	LastClaimAt time.Time `json:"lastClaimAt"`
+	PrevClaimID uint64    `json:"prevClaimId,omitempty"`
+	PrevClaimAt time.Time `json:"prevClaimAt"`
+	ResetAt     time.Time `json:"resetAt"` // 运维重置申请间隔的时间，释放申请时不再恢复这之前的申请
+	Claims      uint64    `json:"claims"`  // 成功申请的次数
+}
+
+// UserRecord 一个微信用户最近一次成功的申请和当天的申请次数
+type UserRecord struct {
+	OpenID      string    `json:"openid"`
+	LastClaimID uint64    `json:"lastClaimId"`
+	LastClaimAt time.Time `json:"lastClaimAt"`
+	PrevClaimID uint64    `json:"prevClaimId,omitempty"`
+	PrevClaimAt time.Time `json:"prevClaimAt"`
+	ResetAt     time.Time `json:"resetAt"` // 运维重置申请间隔的时间，释放申请时不再恢复这之前的申请
+	Claims      uint64    `json:"claims"`
+	Confirmed   uint64    `json:"confirmed"` // 交易已经上链的申请次数，Claims还包括排队和未上链的申请
+	Day         string    `json:"day"`       // DayClaims统计的日期，格式为2006-01-02
+	DayClaims   uint64    `json:"dayClaims"` // Day当天的申请次数
+}
+
+// dayOf 按本地时区返回时间所在的日期
+func dayOf(t time.Time) string {
+	return t.Local().Format("2006-01-02")
+}
+
+// UpdateClaim 更新申请记录的状态、交易hash和失败原因
+func (s *Store) UpdateClaim(id uint64, status ClaimStatus, txHash, reason string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		claims := tx.Bucket(claimBucket)
+		record := new(ClaimRecord)
+		if err := getJSON(claims, itob(id), record); err != nil {
+			return err
+		}
+		record.Status = status
+		if txHash != "" {
+			record.TxHash = txHash
+		}
+		record.Error = reason
+		record.UpdatedAt = time.Now()
+		return putJSON(claims, itob(id), record)
+	})
+}
+
+// GetClaim 根据id获取申请记录
+func (s *Store) GetClaim(id uint64) (*ClaimRecord, error) {
+	record := new(ClaimRecord)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(claimBucket), itob(id), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// RecentPayouts 按时间从新到旧返回最近limit条已经到账的申请，最多查找最近的maxScan条申请
+func (s *Store) RecentPayouts(limit, maxScan int) ([]*ClaimRecord, error) {
+	var records []*ClaimRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(claimBucket).Cursor()
+		scanned := 0
+		for k, v := c.Last(); k != nil && len(records) < limit && scanned < maxScan; k, v = c.Prev() {
+			scanned++
+			record := new(ClaimRecord)
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+			if record.Status == StatusConfirmed {
+				records = append(records, record)
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// GetAddress 获取地址最近一次成功的申请，没有申请过返回ErrNotFound
+func (s *Store) GetAddress(address string) (*AddressRecord, error) {
+	record := new(AddressRecord)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(addressBucket), []byte(normalizeAddress(address)), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// GetUser 获取微信用户最近一次成功的申请，没有申请过返回ErrNotFound
+func (s *Store) GetUser(openid string) (*UserRecord, error) {
+	record := new(UserRecord)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(userBucket), []byte(openid), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// updateIndexes 更新地址和用户的最近申请记录，原来最近的申请记为上一次申请
+func updateIndexes(tx *bolt.Tx, record *ClaimRecord) error {
+	addresses := tx.Bucket(addressBucket)
+	addr := &AddressRecord{Address: record.Address}
+	if err := getJSON(addresses, []byte(record.Address), addr); err != nil && err != ErrNotFound {
+		return err
+	}
+	addr.PrevClaimID, addr.PrevClaimAt = addr.LastClaimID, addr.LastClaimAt
+	addr.LastClaimID = record.ID
+	addr.LastClaimAt = record.CreatedAt
+	addr.Claims++
+	if err := putJSON(addresses, []byte(record.Address), addr); err != nil {
+		return err
+	}
+
+	if err := updateIPIndex(tx, record); err != nil {
+		return err
+	}
+	if record.OpenID == "" {
+		return nil
+	}
+	users := tx.Bucket(userBucket)
+	user := &UserRecord{OpenID: record.OpenID}
+	if err := getJSON(users, []byte(record.OpenID), user); err != nil && err != ErrNotFound {
+		return err
+	}
+	user.PrevClaimID, user.PrevClaimAt = user.LastClaimID, user.LastClaimAt
+	user.LastClaimID = record.ID
+	user.LastClaimAt = record.CreatedAt
+	user.Claims++
+	if day := dayOf(record.CreatedAt); user.Day != day {
+		user.Day, user.DayClaims = day, 0
+	}
+	user.DayClaims++
+	return putJSON(users, []byte(record.OpenID), user)
+}
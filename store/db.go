@@ -1,75 +1,74 @@
-// 存储LemoAddress对应的交易的时间戳
+// 水龙头的持久化存储，基于boltdb，进程内只打开一次db文件
 package store
 
 import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"github.com/boltdb/bolt"
 	"log"
-	"strconv"
 	"strings"
+	"time"
 )
 
-const dbfile = "bolt.db"
+var ErrNotFound = errors.New("not found")
 
-// 存储 key = LemoAddress,value = tx.Expiration
-func Putdb(LemoAddress string, expiration uint64) error {
-	// 把地址转换为大写
-	LemoAddress = strings.ToUpper(LemoAddress)
-	db, err := bolt.Open(dbfile, 0600, nil)
+// Store 持有一个长期打开的bolt.db句柄，可以被多个goroutine并发使用
+type Store struct {
+	db     *bolt.DB
+	policy Policy
+}
+
+// Open 打开db文件，创建需要的表并把旧版本的数据迁移到当前版本
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 3 * time.Second})
 	if err != nil {
 		log.Println("open db file error:", err)
-		return err
+		return nil, err
 	}
-	defer db.Close()
-	// 创建/打开一个表
-	err = db.Update(func(tx *bolt.Tx) error {
-		// 打开一个表，如果不存在则创建
-		b, err := tx.CreateBucketIfNotExists([]byte("bucket"))
-		if err != nil {
-			log.Println("open bucket error:", err)
-			return err
-		}
-		// uint64转string
-		str := strconv.FormatUint(expiration, 10)
-		// 对表进行操作,这里是put操作
-		err = b.Put([]byte(LemoAddress), []byte(str))
-		return err
-	})
+	s := &Store{db: db}
+	if err = db.Update(s.migrate); err != nil {
+		log.Println("migrate db error:", err)
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
 
-	return err
+// Close 关闭db文件
+func (s *Store) Close() error {
+	return s.db.Close()
 }
 
-// 获得db中LemoAddress对应的时间戳
-func Getdb(LemoAddress string) (uint64, error) {
-	// 把地址转换为大写
-	LemoAddress = strings.ToUpper(LemoAddress)
-	var time uint64
-	db, err := bolt.Open(dbfile, 0600, nil)
-	if err != nil {
-		log.Println("open db file error:", err)
-		return 0, err
+// normalizeAddress 地址统一转换为大写作为key
+func normalizeAddress(address string) string {
+	return strings.ToUpper(address)
+}
+
+// itob uint64 转为大端序的8字节，保证bolt中按id顺序遍历
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func btoi(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
+
+// getJSON 读取key对应的json数据，key不存在时返回ErrNotFound
+func getJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	data := b.Get(key)
+	if data == nil {
+		return ErrNotFound
 	}
-	defer db.Close()
-	err = db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("bucket"))
-		if err != nil {
-			log.Println("tx.CreateBucketIfNotExists error:", err)
-			return err
-		}
-		byteTime := b.Get([]byte(LemoAddress))
-		// 如果db没有这个key,则返回nil
-		if byteTime == nil {
-			time = 0
-			return nil
-		} else {
-			// []byte 转 uint64
-			time, err = strconv.ParseUint(string(byteTime), 10, 64)
-			if err != nil {
-				log.Println("parse uint64 error:", err)
-				return err
-			}
-		}
-		return nil
-	})
+	return json.Unmarshal(data, v)
+}
 
-	return time, err
+func putJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
 }
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+// 通过http接口申请的客户端ip最近一次成功的申请，key = ip, value = IPRecord
+var ipBucket = []byte("ips")
+
+// IPRecord 与UserRecord相同，按客户端ip统计
+type IPRecord struct {
+	IP          string    `json:"ip"`
+	LastClaimID uint64    `json:"lastClaimId"`
+	LastClaimAt time.Time `json:"lastClaimAt"`
+	PrevClaimID uint64    `json:"prevClaimId,omitempty"`
+	PrevClaimAt time.Time `json:"prevClaimAt"`
+	ResetAt     time.Time `json:"resetAt"` // 运维重置申请间隔的时间，释放申请时不再恢复这之前的申请
+	Claims      uint64    `json:"claims"`
+	Day         string    `json:"day"`
+	DayClaims   uint64    `json:"dayClaims"`
+}
+
+// IPLimitError 客户端ip的申请超过限制
+type IPLimitError struct {
+	Wait       time.Duration // 还需要等待的时间
+	QuotaSpent bool          // true表示当天的申请次数已用完，false表示距离上次申请的时间间隔不够
+}
+
+func (e *IPLimitError) Error() string {
+	if e.QuotaSpent {
+		return fmt.Sprintf("ip daily quota spent, wait %s", e.Wait)
+	}
+	return fmt.Sprintf("ip claim cooldown, wait %s", e.Wait)
+}
+
+// GetIP 获取客户端ip最近一次成功的申请，没有申请过返回ErrNotFound
+func (s *Store) GetIP(ip string) (*IPRecord, error) {
+	record := new(IPRecord)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(ipBucket), []byte(ip), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// CountIPClaims 统计since之后按ip限制的渠道(http接口和网页)的申请数，包括失败的申请
+func (s *Store) CountIPClaims(since time.Time) (uint64, error) {
+	var count uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(claimBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			record := new(ClaimRecord)
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+			if record.CreatedAt.Before(since) {
+				return nil
+			}
+			if record.IP != "" {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// checkIP 检查客户端ip的申请间隔和每天的申请次数，interval和quota为0表示不限制
+func checkIP(tx *bolt.Tx, ip string, interval time.Duration, quota uint64, now time.Time) error {
+	if ip == "" {
+		return nil
+	}
+	last := new(IPRecord)
+	err := getJSON(tx.Bucket(ipBucket), []byte(ip), last)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if interval > 0 {
+		if next := last.LastClaimAt.Add(interval); now.Before(next) {
+			return &IPLimitError{Wait: next.Sub(now)}
+		}
+	}
+	if quota > 0 && last.Day == dayOf(now) && last.DayClaims >= quota {
+		local := now.Local()
+		tomorrow := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, local.Location())
+		return &IPLimitError{Wait: tomorrow.Sub(now), QuotaSpent: true}
+	}
+	return nil
+}
+
+// updateIPIndex 更新客户端ip的最近申请记录
+func updateIPIndex(tx *bolt.Tx, record *ClaimRecord) error {
+	if record.IP == "" {
+		return nil
+	}
+	ips := tx.Bucket(ipBucket)
+	last := &IPRecord{IP: record.IP}
+	if err := getJSON(ips, []byte(record.IP), last); err != nil && err != ErrNotFound {
+		return err
+	}
+	last.PrevClaimID, last.PrevClaimAt = last.LastClaimID, last.LastClaimAt
+	last.LastClaimID = record.ID
+	last.LastClaimAt = record.CreatedAt
+	last.Claims++
+	if day := dayOf(record.CreatedAt); last.Day != day {
+		last.Day, last.DayClaims = day, 0
+	}
+	last.DayClaims++
+	return putJSON(ips, []byte(record.IP), last)
+}
+
+// restoreIPIndex 撤销updateIPIndex
+func restoreIPIndex(tx *bolt.Tx, released *ClaimRecord) error {
+	if released.IP == "" {
+		return nil
+	}
+	ips := tx.Bucket(ipBucket)
+	last := new(IPRecord)
+	if err := getJSON(ips, []byte(released.IP), last); err != nil {
+		return err
+	}
+	last.Claims--
+	if last.Day == dayOf(released.CreatedAt) && last.DayClaims > 0 && !released.CreatedAt.Before(last.ResetAt) {
+		last.DayClaims--
+	}
+	if last.Claims == 0 {
+		return ips.Delete([]byte(released.IP))
+	}
+	restoreLast(&last.LastClaimID, &last.LastClaimAt, &last.PrevClaimID, &last.PrevClaimAt, released.ID, last.ResetAt)
+	return putJSON(ips, []byte(released.IP), last)
+}
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"math/big"
+	"time"
+)
+
+var (
+	// 黑名单和白名单，key = 名单:类型:值，例如 black:address:LEMO83..., value = ListEntry
+	listBucket = []byte("lists")
+	// 名单的修改记录，用于审计，key = 自增id, value = ListAudit
+	listAuditBucket = []byte("listAudit")
+)
+
+// 名单
+const (
+	Blacklist = "black" // 黑名单中的地址、微信用户和ip不能申请，已经在打币队列中的申请在发送交易之前也会被拒绝
+	Whitelist = "white" // 白名单中的地址、微信用户和ip可以使用条目的打币数量和申请间隔，仍然受发放上限的限制
+)
+
+// 名单条目和运维操作对象的类型
+const (
+	TargetAddress = "address"
+	TargetOpenID  = "openid"
+	TargetIP      = "ip"
+)
+
+// 名单修改记录的操作
+const (
+	ListAdded    = "add"
+	ListRemoved  = "remove"
+	ListImported = "import"
+)
+
+// ListEntry 名单中的一个地址、微信用户或ip
+type ListEntry struct {
+	List      string    `json:"list"`
+	Target    string    `json:"target"` // 类型，见TargetAddress等
+	Value     string    `json:"value"`
+	Amount    string    `json:"amount,omitempty"`    // 白名单: 每次打币的数量，单位为mo，空表示使用默认数量
+	Interval  uint64    `json:"interval,omitempty"`  // 白名单: 申请间隔，单位秒，设置后代替默认的申请间隔并且不限制每天的申请次数，0表示使用默认的限制
+	Unlimited bool      `json:"unlimited,omitempty"` // 白名单: 不限制申请间隔和每天的申请次数，必须明确设置
+	ExpiresAt time.Time `json:"expiresAt"`           // 过期时间，过期后不再生效，零值表示永久有效
+	Reason    string    `json:"reason,omitempty"`    // 加入名单的原因
+	By        string    `json:"by,omitempty"`        // 操作人
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Expired 条目在now时是否已经过期
+func (e *ListEntry) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// ListAudit 一次名单的修改，Entry为加入或者移出的条目，Reason和By为本次操作的原因和操作人
+type ListAudit struct {
+	ID     uint64     `json:"id"`
+	Action string     `json:"action"`
+	Entry  *ListEntry `json:"entry"`
+	Reason string     `json:"reason,omitempty"`
+	By     string     `json:"by,omitempty"`
+	Time   time.Time  `json:"time"`
+}
+
+// BlacklistError 申请的地址、微信用户或ip在黑名单中，原因只记录在名单中，不返回给申请人
+type BlacklistError struct {
+	Entry *ListEntry
+}
+
+func (e *BlacklistError) Error() string {
+	return fmt.Sprintf("%s %s is blacklisted", e.Entry.Target, e.Entry.Value)
+}
+
+// listKey 名单条目的key，地址统一转换为大写
+func listKey(list, target, value string) []byte {
+	if target == TargetAddress {
+		value = normalizeAddress(value)
+	}
+	return []byte(list + ":" + target + ":" + value)
+}
+
+// checkTarget 检查名单和类型是否正确
+func checkTarget(list, target string) error {
+	if list != Blacklist && list != Whitelist {
+		return fmt.Errorf("unknown list %q", list)
+	}
+	if target != TargetAddress && target != TargetOpenID && target != TargetIP {
+		return fmt.Errorf("unknown list target %q", target)
+	}
+	return nil
+}
+
+// checkEntry 检查条目是否正确，只有白名单可以设置打币数量和申请间隔，申请间隔和不限制不能同时设置
+func checkEntry(entry *ListEntry) error {
+	if err := checkTarget(entry.List, entry.Target); err != nil {
+		return err
+	}
+	if entry.Value == "" {
+		return errors.New("empty list value")
+	}
+	if entry.List == Blacklist && (entry.Amount != "" || entry.Interval > 0 || entry.Unlimited) {
+		return errors.New("amount, interval and unlimited are only allowed in whitelist")
+	}
+	if entry.Interval > 0 && entry.Unlimited {
+		return errors.New("interval and unlimited can not be set together")
+	}
+	if entry.Amount != "" {
+		amount, ok := new(big.Int).SetString(entry.Amount, 10)
+		if !ok || amount.Sign() <= 0 {
+			return fmt.Errorf("invalid whitelist amount %q", entry.Amount)
+		}
+	}
+	return nil
+}
+
+// AddListEntry 把地址、微信用户或ip加入名单，已经在名单中时覆盖原来的条目，并记录修改
+func (s *Store) AddListEntry(entry *ListEntry) error {
+	if entry.Target == TargetAddress {
+		entry.Value = normalizeAddress(entry.Value)
+	}
+	if err := checkEntry(entry); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return addListEntry(tx, entry, ListAdded, entry.By, entry.CreatedAt)
+	})
+}
+
+// addListEntry 保存条目并记录修改，by和now为本次操作的操作人和时间
+func addListEntry(tx *bolt.Tx, entry *ListEntry, action, by string, now time.Time) error {
+	if err := putJSON(tx.Bucket(listBucket), listKey(entry.List, entry.Target, entry.Value), entry); err != nil {
+		return err
+	}
+	return auditList(tx, &ListAudit{Action: action, Entry: entry, Reason: entry.Reason, By: by, Time: now})
+}
+
+// RemoveListEntry 把地址、微信用户或ip移出名单，并记录移出的原因和操作人，不在名单中返回ErrNotFound
+func (s *Store) RemoveListEntry(list, target, value, reason, by string, now time.Time) error {
+	if err := checkTarget(list, target); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(listBucket)
+		key := listKey(list, target, value)
+		entry := new(ListEntry)
+		if err := getJSON(entries, key, entry); err != nil {
+			return err
+		}
+		if err := entries.Delete(key); err != nil {
+			return err
+		}
+		return auditList(tx, &ListAudit{Action: ListRemoved, Entry: entry, Reason: reason, By: by, Time: now})
+	})
+}
+
+// ListEntries 返回名单中的所有条目，包括已经过期的条目
+func (s *Store) ListEntries(list string) ([]*ListEntry, error) {
+	var entries []*ListEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := []byte(list + ":")
+		c := tx.Bucket(listBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			entry := new(ListEntry)
+			if err := json.Unmarshal(v, entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// auditList 记录一次名单的修改
+func auditList(tx *bolt.Tx, audit *ListAudit) error {
+	audits := tx.Bucket(listAuditBucket)
+	id, err := audits.NextSequence()
+	if err != nil {
+		return err
+	}
+	audit.ID = id
+	return putJSON(audits, itob(id), audit)
+}
+
+// ListAuditLog 按时间从新到旧返回最近limit条名单的修改记录
+func (s *Store) ListAuditLog(limit int) ([]*ListAudit, error) {
+	var audits []*ListAudit
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(listAuditBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(audits) < limit; k, v = c.Prev() {
+			audit := new(ListAudit)
+			if err := json.Unmarshal(v, audit); err != nil {
+				return err
+			}
+			audits = append(audits, audit)
+		}
+		return nil
+	})
+	return audits, err
+}
+
+// findEntry 按地址、微信用户、ip的顺序查找申请在名单中未过期的条目，没有返回nil
+func findEntry(tx *bolt.Tx, list string, record *ClaimRecord, now time.Time) (*ListEntry, error) {
+	targets := [][2]string{{TargetAddress, record.Address}, {TargetOpenID, record.OpenID}, {TargetIP, record.IP}}
+	entries := tx.Bucket(listBucket)
+	for _, target := range targets {
+		if target[1] == "" {
+			continue
+		}
+		entry := new(ListEntry)
+		err := getJSON(entries, listKey(list, target[0], target[1]), entry)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !entry.Expired(now) {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkLists 检查申请的地址、微信用户和ip，在黑名单中返回BlacklistError，否则返回白名单中的条目，不在白名单中为nil
+func checkLists(tx *bolt.Tx, record *ClaimRecord, now time.Time) (*ListEntry, error) {
+	black, err := findEntry(tx, Blacklist, record, now)
+	if err != nil {
+		return nil, err
+	}
+	if black != nil {
+		return nil, &BlacklistError{Entry: black}
+	}
+	return findEntry(tx, Whitelist, record, now)
+}
+
+// CheckBlacklist 在发送交易之前再次检查申请是否在黑名单中，用于拒绝加入队列之后才被拉黑的申请。
+// 运维手动打币的申请不检查
+func (s *Store) CheckBlacklist(record *ClaimRecord, now time.Time) error {
+	if record.Channel == ChannelAdmin {
+		return nil
+	}
+	return s.db.View(func(tx *bolt.Tx) error {
+		black, err := findEntry(tx, Blacklist, record, now)
+		if err != nil {
+			return err
+		}
+		if black != nil {
+			return &BlacklistError{Entry: black}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func addWhitelist(t *testing.T, db *Store, entry *ListEntry) {
+	entry.List, entry.Target, entry.Value = Whitelist, TargetAddress, testAddress
+	if err := db.AddListEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 白名单条目没有设置申请间隔时仍使用默认的申请间隔和次数
+func TestWhitelistDefaultsToPolicy(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10", AddressInterval: time.Hour, UserDailyQuota: 1})
+	addWhitelist(t, db, &ListEntry{Amount: "20"})
+	now := time.Now()
+	claim, err := db.Reserve(testAddress, "user", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.Amount != "20" {
+		t.Fatalf("amount = %s, want 20", claim.Amount)
+	}
+	if _, err = db.Reserve(testAddress, "user", now.Add(time.Minute)); err == nil {
+		t.Fatal("whitelist entry without interval should keep the policy limits")
+	}
+}
+
+// 设置了申请间隔时代替默认的申请间隔，并且不限制每天的申请次数
+func TestWhitelistInterval(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10", AddressInterval: time.Hour, UserDailyQuota: 1})
+	addWhitelist(t, db, &ListEntry{Interval: 60})
+	now := time.Now()
+	if _, err := db.Reserve(testAddress, "user", now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Reserve(testAddress, "user", now.Add(30*time.Second)); err == nil {
+		t.Fatal("claim within the whitelist interval should fail")
+	}
+	if _, err := db.Reserve(testAddress, "user", now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 只有明确设置Unlimited时才不限制申请间隔和次数
+func TestWhitelistUnlimited(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10", AddressInterval: time.Hour, UserDailyQuota: 1})
+	addWhitelist(t, db, &ListEntry{Unlimited: true})
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := db.Reserve(testAddress, "user", now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AddListEntry(&ListEntry{List: Whitelist, Target: TargetAddress, Value: testAddress, Interval: 60, Unlimited: true}); err == nil {
+		t.Fatal("interval and unlimited should not be allowed together")
+	}
+}
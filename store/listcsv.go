@@ -0,0 +1,122 @@
+package store
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// 名单的csv格式，第一行为表头。interval单位为秒，unlimited为true或空，expiresAt和createdAt为RFC3339格式，expiresAt为空表示永久有效
+var listCSVHeader = []string{"list", "target", "value", "amount", "interval", "unlimited", "expiresAt", "reason", "by", "createdAt"}
+
+// ExportLists 把黑名单和白名单中的所有条目导出为csv
+func (s *Store) ExportLists(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(listCSVHeader); err != nil {
+		return err
+	}
+	for _, list := range []string{Blacklist, Whitelist} {
+		entries, err := s.ListEntries(list)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err = writer.Write(entryRow(entry)); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ImportLists 从csv导入名单条目，覆盖已有的相同条目，返回导入的条数。
+// 所有条目在一个事务中导入，任意一行不正确时都不导入。by和createdAt列为空时使用导入的操作人和时间
+func (s *Store) ImportLists(r io.Reader, by string, now time.Time) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(listCSVHeader)
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	line := 0
+	if len(rows) > 0 && rows[0][0] == listCSVHeader[0] {
+		rows, line = rows[1:], 1
+	}
+	entries := make([]*ListEntry, 0, len(rows))
+	for _, row := range rows {
+		line++
+		entry, err := parseEntryRow(row, by, now)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		for _, entry := range entries {
+			if err := addListEntry(tx, entry, ListImported, by, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// entryRow 把条目转换为csv的一行
+func entryRow(entry *ListEntry) []string {
+	interval, unlimited, expiresAt := "", "", ""
+	if entry.Interval > 0 {
+		interval = strconv.FormatUint(entry.Interval, 10)
+	}
+	if entry.Unlimited {
+		unlimited = "true"
+	}
+	if !entry.ExpiresAt.IsZero() {
+		expiresAt = entry.ExpiresAt.Format(time.RFC3339)
+	}
+	return []string{entry.List, entry.Target, entry.Value, entry.Amount, interval, unlimited, expiresAt, entry.Reason, entry.By, entry.CreatedAt.Format(time.RFC3339)}
+}
+
+// parseEntryRow 解析csv的一行并检查条目是否正确
+func parseEntryRow(row []string, by string, now time.Time) (*ListEntry, error) {
+	entry := &ListEntry{List: row[0], Target: row[1], Value: row[2], Amount: row[3], Reason: row[7], By: row[8], CreatedAt: now}
+	var err error
+	if row[4] != "" {
+		if entry.Interval, err = strconv.ParseUint(row[4], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid interval %q", row[4])
+		}
+	}
+	if row[5] != "" {
+		if entry.Unlimited, err = strconv.ParseBool(row[5]); err != nil {
+			return nil, fmt.Errorf("invalid unlimited %q", row[5])
+		}
+	}
+	if row[6] != "" {
+		if entry.ExpiresAt, err = time.Parse(time.RFC3339, row[6]); err != nil {
+			return nil, fmt.Errorf("invalid expiresAt %q", row[6])
+		}
+	}
+	if row[9] != "" {
+		if entry.CreatedAt, err = time.Parse(time.RFC3339, row[9]); err != nil {
+			return nil, fmt.Errorf("invalid createdAt %q", row[9])
+		}
+	}
+	if entry.By == "" {
+		entry.By = by
+	}
+	if entry.Target == TargetAddress {
+		entry.Value = normalizeAddress(entry.Value)
+	}
+	if err = checkEntry(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
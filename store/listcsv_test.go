@@ -0,0 +1,89 @@
+package store
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListCSVRoundTrip(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10"})
+	now := time.Now().Truncate(time.Second)
+	entries := []*ListEntry{
+		{List: Blacklist, Target: TargetIP, Value: "203.0.113.7", Reason: "脚本批量申请, 多个地址", By: "ops", CreatedAt: now},
+		{List: Whitelist, Target: TargetAddress, Value: testAddress, Amount: "100", Interval: 3600, ExpiresAt: now.Add(24 * time.Hour), Reason: "内部开发", By: "ops", CreatedAt: now},
+		{List: Whitelist, Target: TargetOpenID, Value: "user", Unlimited: true, By: "ops", CreatedAt: now},
+	}
+	for _, entry := range entries {
+		if err := db.AddListEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var exported bytes.Buffer
+	if err := db.ExportLists(&exported); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := openTestStore(t, Policy{Amount: "10"})
+	n, err := imported.ImportLists(bytes.NewReader(exported.Bytes()), "importer", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(entries) {
+		t.Fatalf("imported %d entries, want %d", n, len(entries))
+	}
+	for _, list := range []string{Blacklist, Whitelist} {
+		want, err := db.ListEntries(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := imported.ListEntries(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%slist has %d entries, want %d", list, len(got), len(want))
+		}
+		for i := range want {
+			// 时间经过RFC3339格式化后时区可能不同
+			if !got[i].CreatedAt.Equal(want[i].CreatedAt) || !got[i].ExpiresAt.Equal(want[i].ExpiresAt) {
+				t.Fatalf("entry %s times = %v %v, want %v %v", want[i].Value, got[i].CreatedAt, got[i].ExpiresAt, want[i].CreatedAt, want[i].ExpiresAt)
+			}
+			got[i].CreatedAt, got[i].ExpiresAt = want[i].CreatedAt, want[i].ExpiresAt
+			if !reflect.DeepEqual(got[i], want[i]) {
+				t.Fatalf("imported entry %+v, want %+v", got[i], want[i])
+			}
+		}
+	}
+
+	var reexported bytes.Buffer
+	if err = imported.ExportLists(&reexported); err != nil {
+		t.Fatal(err)
+	}
+	if reexported.String() != exported.String() {
+		t.Fatalf("export after import differs:\n%s\nwant:\n%s", reexported.String(), exported.String())
+	}
+}
+
+// 任意一行不正确时都不导入，错误中带有行号
+func TestImportListsRejectsInvalidRow(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10"})
+	csv := strings.Join([]string{
+		strings.Join(listCSVHeader, ","),
+		"black,ip,203.0.113.7,,,,,,,",
+		"black,address," + testAddress + ",100,,,,,,",
+	}, "\n")
+	_, err := db.ImportLists(strings.NewReader(csv), "importer", time.Now())
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Fatalf("import returned %v, want an error on line 3", err)
+	}
+	entries, err := db.ListEntries(Blacklist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("%d entries imported from an invalid csv", len(entries))
+	}
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+// 已经发送给节点、等待确认的申请，key = 申请id
+var pendingBucket = []byte("pending")
+
+// PendingClaims 返回所有等待确认的申请
+func (s *Store) PendingClaims() ([]*ClaimRecord, error) {
+	var records []*ClaimRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		claims := tx.Bucket(claimBucket)
+		return tx.Bucket(pendingBucket).ForEach(func(k, _ []byte) error {
+			record := new(ClaimRecord)
+			if err := getJSON(claims, k, record); err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// pendingClaim 读取等待确认的申请并移出等待确认的列表
+func pendingClaim(tx *bolt.Tx, id uint64) (*ClaimRecord, error) {
+	record := new(ClaimRecord)
+	if err := getJSON(tx.Bucket(claimBucket), itob(id), record); err != nil {
+		return nil, err
+	}
+	if record.Status != StatusPending {
+		return nil, fmt.Errorf("claim %d is %s, not pending", id, record.Status)
+	}
+	return record, tx.Bucket(pendingBucket).Delete(itob(id))
+}
+
+// Confirm 交易已经上链，增加微信用户上链的申请次数
+func (s *Store) Confirm(id uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		record, err := pendingClaim(tx, id)
+		if err != nil {
+			return err
+		}
+		record.Status = StatusConfirmed
+		record.Error = ""
+		record.UpdatedAt = time.Now()
+		if err = putJSON(tx.Bucket(claimBucket), itob(id), record); err != nil {
+			return err
+		}
+		if record.OpenID == "" {
+			return nil
+		}
+		users := tx.Bucket(userBucket)
+		user := new(UserRecord)
+		if err = getJSON(users, []byte(record.OpenID), user); err != nil {
+			if err == ErrNotFound {
+				return nil
+			}
+			return err
+		}
+		user.Confirmed++
+		return putJSON(users, []byte(record.OpenID), user)
+	})
+}
+
+// Requeue 交易过期未上链，重新加入打币队列，申请间隔和发放额度保持占用
+func (s *Store) Requeue(id uint64, reason string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		record, err := pendingClaim(tx, id)
+		if err != nil {
+			return err
+		}
+		record.Status = StatusQueued
+		record.Error = reason
+		record.UpdatedAt = time.Now()
+		if err = tx.Bucket(queueBucket).Put(itob(id), nil); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(claimBucket), itob(id), record)
+	})
+}
+
+// Expire 交易过期未上链且不再重发，退回发放额度和申请间隔
+func (s *Store) Expire(id uint64, reason string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		record, err := pendingClaim(tx, id)
+		if err != nil {
+			return err
+		}
+		return release(tx, record, StatusExpired, reason)
+	})
+}
+
+// AbandonPending 交易过期时仍然无法查询交易状态，不知道交易是否已经上链，标记为失败且不再重发，也不退回发放额度和申请间隔
+func (s *Store) AbandonPending(id uint64, reason string) (*ClaimRecord, error) {
+	var record *ClaimRecord
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if record, err = pendingClaim(tx, id); err != nil {
+			return err
+		}
+		record.Status = StatusFailed
+		record.Error = reason
+		record.UpdatedAt = time.Now()
+		return putJSON(tx.Bucket(claimBucket), itob(id), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
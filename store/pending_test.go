@@ -0,0 +1,38 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+// 只有交易上链的申请计入Confirmed，排队和未上链的申请只计入Claims
+func TestConfirmCountsConfirmedClaims(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10"})
+	now := time.Now()
+	first, err := db.Reserve(testAddress, "user", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Reserve(otherAddress, "user", now); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Commit(first.ID, "0x01"); err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.GetUser("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Claims != 2 || user.Confirmed != 0 {
+		t.Fatalf("before confirm: claims %d, confirmed %d", user.Claims, user.Confirmed)
+	}
+	if err = db.Confirm(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if user, err = db.GetUser("user"); err != nil {
+		t.Fatal(err)
+	}
+	if user.Claims != 2 || user.Confirmed != 1 {
+		t.Fatalf("after confirm: claims %d, confirmed %d, want 2 and 1", user.Claims, user.Confirmed)
+	}
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+// 打币队列，key = 申请id，按id顺序先进先出，Commit或Release之后从队列中删除
+var queueBucket = []byte("queue")
+
+// QueuedClaims 按申请的先后顺序返回队列中最多limit条申请
+func (s *Store) QueuedClaims(limit int) ([]*ClaimRecord, error) {
+	var records []*ClaimRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		claims := tx.Bucket(claimBucket)
+		c := tx.Bucket(queueBucket).Cursor()
+		for k, _ := c.First(); k != nil && len(records) < limit; k, _ = c.Next() {
+			record := new(ClaimRecord)
+			if err := getJSON(claims, k, record); err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// MarkSending 开始发送交易之前把申请标记为发送中并记录交易的过期时间，进程重启时用来识别可能已经发出的交易
+func (s *Store) MarkSending(id uint64, expiration int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		record, err := reservedClaim(tx, id)
+		if err != nil {
+			return err
+		}
+		record.Status = StatusSending
+		record.Attempts++
+		record.Expiration = expiration
+		record.UpdatedAt = time.Now()
+		return putJSON(tx.Bucket(claimBucket), itob(id), record)
+	})
+}
+
+// RecoverQueue 进程启动时处理上次退出时正在发送的申请。
+// 无法确定这些交易是否已经发送到节点，为了避免重复打币，把它们标记为失败并移出队列，但不退回申请间隔和发放额度
+func (s *Store) RecoverQueue() ([]*ClaimRecord, error) {
+	var recovered []*ClaimRecord
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		claims := tx.Bucket(claimBucket)
+		queue := tx.Bucket(queueBucket)
+		var interrupted [][]byte
+		err := queue.ForEach(func(k, _ []byte) error {
+			record := new(ClaimRecord)
+			if err := getJSON(claims, k, record); err != nil {
+				return err
+			}
+			if record.Status != StatusSending {
+				return nil
+			}
+			record.Status = StatusFailed
+			record.Error = "interrupted while sending"
+			record.UpdatedAt = time.Now()
+			if err := putJSON(claims, k, record); err != nil {
+				return err
+			}
+			interrupted = append(interrupted, k)
+			recovered = append(recovered, record)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range interrupted {
+			if err := queue.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return recovered, err
+}
+
+// Abandon 交易可能已经发送但无法记录结果时，把申请标记为失败并移出队列。
+// 与RecoverQueue相同，不退回申请间隔和发放额度，避免重复打币，txHash不为空时记录下来便于人工核对
+func (s *Store) Abandon(id uint64, txHash, reason string) (*ClaimRecord, error) {
+	var record *ClaimRecord
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if record, err = reservedClaim(tx, id); err != nil {
+			return err
+		}
+		record.Status = StatusFailed
+		if txHash != "" {
+			record.TxHash = txHash
+		}
+		record.Error = reason
+		record.UpdatedAt = time.Now()
+		if err = tx.Bucket(queueBucket).Delete(itob(id)); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(claimBucket), itob(id), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
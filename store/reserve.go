@@ -0,0 +1,308 @@
+package store
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	"math/big"
+	"time"
+)
+
+// Policy 申请测试币的限制
+type Policy struct {
+	Amount          string        // 每次打币的数量，单位为mo
+	AddressInterval time.Duration // 同一个地址两次申请的最小间隔
+	UserInterval    time.Duration // 同一个微信用户两次申请的最小间隔，0表示不限制
+	UserDailyQuota  uint64        // 同一个微信用户每天最多申请的次数，0表示不限制
+	IPInterval      time.Duration // 通过http接口申请时，同一个ip两次申请的最小间隔，0表示不限制
+	IPDailyQuota    uint64        // 通过http接口申请时，同一个ip每天最多申请的次数，0表示不限制
+	HourlyCap       *big.Int      // 每小时最多发放的测试币，nil表示不限制
+	DailyCap        *big.Int      // 每天最多发放的测试币，nil表示不限制
+}
+
+// SetPolicy 设置申请限制，必须在Reserve之前调用
+func (s *Store) SetPolicy(p Policy) {
+	s.policy = p
+}
+
+// CooldownError 距离上次申请的时间间隔不够
+type CooldownError struct {
+	Interval time.Duration // 地址的申请间隔，在白名单中时为条目的申请间隔
+	Wait     time.Duration // 还需要等待的时间
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("claim cooldown, wait %s", e.Wait)
+}
+
+// UserLimitError 微信用户的申请超过限制
+type UserLimitError struct {
+	Interval   time.Duration // 微信用户的申请间隔，在白名单中时为条目的申请间隔
+	Wait       time.Duration // 还需要等待的时间
+	QuotaSpent bool          // true表示当天的申请次数已用完，false表示距离上次申请的时间间隔不够
+}
+
+func (e *UserLimitError) Error() string {
+	if e.QuotaSpent {
+		return fmt.Sprintf("user daily quota spent, wait %s", e.Wait)
+	}
+	return fmt.Sprintf("user claim cooldown, wait %s", e.Wait)
+}
+
+// checkUser 检查微信用户的申请间隔和每天的申请次数，interval和quota为0表示不限制
+func checkUser(tx *bolt.Tx, openid string, interval time.Duration, quota uint64, now time.Time) error {
+	if openid == "" {
+		return nil
+	}
+	user := new(UserRecord)
+	err := getJSON(tx.Bucket(userBucket), []byte(openid), user)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if interval > 0 {
+		if next := user.LastClaimAt.Add(interval); now.Before(next) {
+			return &UserLimitError{Interval: interval, Wait: next.Sub(now)}
+		}
+	}
+	if quota > 0 && user.Day == dayOf(now) && user.DayClaims >= quota {
+		local := now.Local()
+		tomorrow := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, local.Location())
+		return &UserLimitError{Wait: tomorrow.Sub(now), QuotaSpent: true}
+	}
+	return nil
+}
+
+// Reserve 在一个bolt事务中检查地址和微信用户的申请限制并记录一条预留的申请，保证同一个地址或用户并发申请时只有一个能成功。
+// 预留的申请同时加入打币队列，发送交易之后必须调用Commit或者Release
+func (s *Store) Reserve(address, openid string, now time.Time) (*ClaimRecord, error) {
+	return s.reserve(&ClaimRecord{Address: address, OpenID: openid, Channel: ChannelWeChat}, now, false)
+}
+
+// ReserveIP 与Reserve相同，用于没有微信用户的渠道，按客户端ip限制申请
+func (s *Store) ReserveIP(address, ip, channel string, now time.Time) (*ClaimRecord, error) {
+	return s.reserve(&ClaimRecord{Address: address, IP: ip, Channel: channel}, now, false)
+}
+
+// reserve manual为true时是运维手动打币，跳过所有检查
+func (s *Store) reserve(record *ClaimRecord, now time.Time, manual bool) (*ClaimRecord, error) {
+	openid := record.OpenID
+	record.Address = normalizeAddress(record.Address)
+	record.Amount = s.policy.Amount
+	record.Status = StatusQueued
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if !manual {
+			if err := s.checkLimits(tx, record, now); err != nil {
+				return err
+			}
+		}
+		// 白名单中的条目可能修改了打币数量
+		amount, ok := new(big.Int).SetString(record.Amount, 10)
+		if !ok {
+			return fmt.Errorf("invalid claim amount %q", record.Amount)
+		}
+		if !manual {
+			if err := s.checkBudget(tx, now, amount); err != nil {
+				return err
+			}
+		}
+		err := addBudget(tx, now, amount)
+		if err != nil {
+			return err
+		}
+		if record.Scene, err = claimScene(tx, openid); err != nil {
+			return err
+		}
+
+		claims := tx.Bucket(claimBucket)
+		if record.ID, err = claims.NextSequence(); err != nil {
+			return err
+		}
+		if err = putJSON(claims, itob(record.ID), record); err != nil {
+			return err
+		}
+		if err = tx.Bucket(queueBucket).Put(itob(record.ID), nil); err != nil {
+			return err
+		}
+		return updateIndexes(tx, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// checkLimits 检查暂停状态和名单，再检查地址、微信用户和ip的申请限制。
+// 在白名单中时使用条目的打币数量，条目设置了申请间隔时代替默认的申请间隔并且不限制每天的申请次数，
+// 设置了Unlimited时不限制申请间隔和次数，都没有设置时仍使用默认的限制
+func (s *Store) checkLimits(tx *bolt.Tx, record *ClaimRecord, now time.Time) error {
+	state, err := pauseState(tx)
+	if err != nil {
+		return err
+	}
+	if state.Paused {
+		return ErrPaused
+	}
+	white, err := checkLists(tx, record, now)
+	if err != nil {
+		return err
+	}
+	p := s.policy
+	if white != nil {
+		if white.Unlimited || white.Interval > 0 {
+			interval := time.Duration(white.Interval) * time.Second
+			p.AddressInterval, p.UserInterval, p.IPInterval = interval, interval, interval
+			p.UserDailyQuota, p.IPDailyQuota = 0, 0
+		}
+		if white.Amount != "" {
+			record.Amount = white.Amount
+		}
+		record.Whitelist = white.Target + ":" + white.Value
+	}
+	if err = checkAddress(tx, record.Address, p.AddressInterval, now); err != nil {
+		return err
+	}
+	if err = checkUser(tx, record.OpenID, p.UserInterval, p.UserDailyQuota, now); err != nil {
+		return err
+	}
+	return checkIP(tx, record.IP, p.IPInterval, p.IPDailyQuota, now)
+}
+
+// checkAddress 检查地址的申请间隔，interval为0表示不限制
+func checkAddress(tx *bolt.Tx, address string, interval time.Duration, now time.Time) error {
+	if interval == 0 {
+		return nil
+	}
+	last := new(AddressRecord)
+	err := getJSON(tx.Bucket(addressBucket), []byte(address), last)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if next := last.LastClaimAt.Add(interval); now.Before(next) {
+		return &CooldownError{Interval: interval, Wait: next.Sub(now)}
+	}
+	return nil
+}
+
+// Commit 交易发送成功，记录交易hash，并加入等待确认的列表
+func (s *Store) Commit(id uint64, txHash string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		record, err := reservedClaim(tx, id)
+		if err != nil {
+			return err
+		}
+		record.Status = StatusPending
+		record.TxHash = txHash
+		record.UpdatedAt = time.Now()
+		if err = tx.Bucket(queueBucket).Delete(itob(id)); err != nil {
+			return err
+		}
+		if err = tx.Bucket(pendingBucket).Put(itob(id), nil); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(claimBucket), itob(id), record)
+	})
+}
+
+// Release 交易发送失败，释放预留的申请，地址和用户的最近申请恢复到上一次成功的申请，并退回占用的发放额度
+func (s *Store) Release(id uint64, reason string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		record, err := reservedClaim(tx, id)
+		if err != nil {
+			return err
+		}
+		if err = tx.Bucket(queueBucket).Delete(itob(id)); err != nil {
+			return err
+		}
+		return release(tx, record, StatusFailed, reason)
+	})
+}
+
+// release 把申请标记为最终的失败状态，退回发放额度和申请间隔
+func release(tx *bolt.Tx, record *ClaimRecord, status ClaimStatus, reason string) error {
+	record.Status = status
+	record.Error = reason
+	record.UpdatedAt = time.Now()
+	if err := putJSON(tx.Bucket(claimBucket), itob(record.ID), record); err != nil {
+		return err
+	}
+	if amount, ok := new(big.Int).SetString(record.Amount, 10); ok {
+		if err := addBudget(tx, record.CreatedAt, amount.Neg(amount)); err != nil {
+			return err
+		}
+	}
+	return restoreIndexes(tx, record)
+}
+
+// reservedClaim 读取在打币队列中的申请
+func reservedClaim(tx *bolt.Tx, id uint64) (*ClaimRecord, error) {
+	record := new(ClaimRecord)
+	if err := getJSON(tx.Bucket(claimBucket), itob(id), record); err != nil {
+		return nil, err
+	}
+	if record.Status != StatusQueued && record.Status != StatusSending {
+		return nil, fmt.Errorf("claim %d is %s, not reserved", id, record.Status)
+	}
+	return record, nil
+}
+
+// restoreIndexes 撤销updateIndexes，地址和用户的最近申请恢复为记录的上一次申请
+func restoreIndexes(tx *bolt.Tx, released *ClaimRecord) error {
+	addresses := tx.Bucket(addressBucket)
+	addr := new(AddressRecord)
+	if err := getJSON(addresses, []byte(released.Address), addr); err != nil {
+		return err
+	}
+	addr.Claims--
+	if addr.Claims == 0 {
+		if err := addresses.Delete([]byte(released.Address)); err != nil {
+			return err
+		}
+	} else {
+		restoreLast(&addr.LastClaimID, &addr.LastClaimAt, &addr.PrevClaimID, &addr.PrevClaimAt, released.ID, addr.ResetAt)
+		if err := putJSON(addresses, []byte(released.Address), addr); err != nil {
+			return err
+		}
+	}
+
+	if err := restoreIPIndex(tx, released); err != nil {
+		return err
+	}
+	if released.OpenID == "" {
+		return nil
+	}
+	users := tx.Bucket(userBucket)
+	user := new(UserRecord)
+	if err := getJSON(users, []byte(released.OpenID), user); err != nil {
+		return err
+	}
+	user.Claims--
+	if user.Claims == 0 {
+		return users.Delete([]byte(released.OpenID))
+	}
+	if user.Day == dayOf(released.CreatedAt) && user.DayClaims > 0 && !released.CreatedAt.Before(user.ResetAt) {
+		user.DayClaims--
+	}
+	restoreLast(&user.LastClaimID, &user.LastClaimAt, &user.PrevClaimID, &user.PrevClaimAt, released.ID, user.ResetAt)
+	return putJSON(users, []byte(released.OpenID), user)
+}
+
+// restoreLast 释放的申请是最近的申请时恢复为上一次申请，是上一次申请时清除上一次申请。
+// 只记录了上一次申请，同一个地址、用户或ip连续释放两次时不再限制申请间隔。
+// 上一次申请在运维重置申请间隔(resetAt)之前时不恢复申请时间，避免恢复已经被重置的申请间隔
+func restoreLast(lastID *uint64, lastAt *time.Time, prevID *uint64, prevAt *time.Time, released uint64, resetAt time.Time) {
+	switch released {
+	case *lastID:
+		*lastID, *lastAt = *prevID, *prevAt
+		*prevID, *prevAt = 0, time.Time{}
+		if lastAt.Before(resetAt) {
+			*lastAt = time.Time{}
+		}
+	case *prevID:
+		*prevID, *prevAt = 0, time.Time{}
+	}
+}
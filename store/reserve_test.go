@@ -0,0 +1,199 @@
+package store
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+// reserveConcurrently 并发调用n次reserve，返回成功的次数
+func reserveConcurrently(n int, reserve func(i int) error) int {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		ok int
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if reserve(i) == nil {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return ok
+}
+
+// 同一个地址并发申请时只有一个能成功
+func TestReserveSameAddressConcurrently(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10", AddressInterval: time.Hour})
+	now := time.Now()
+	ok := reserveConcurrently(20, func(i int) error {
+		_, err := db.Reserve(testAddress, "user"+string(rune('a'+i)), now)
+		return err
+	})
+	if ok != 1 {
+		t.Fatalf("%d concurrent reserves succeeded, want 1", ok)
+	}
+}
+
+// 同一个微信用户并发申请不同的地址时只有一个能成功
+func TestReserveSameUserConcurrently(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10", AddressInterval: time.Hour, UserInterval: time.Hour})
+	now := time.Now()
+	ok := reserveConcurrently(20, func(i int) error {
+		address := testAddress
+		if i%2 == 1 {
+			address = otherAddress
+		}
+		_, err := db.Reserve(address, "user", now)
+		return err
+	})
+	if ok != 1 {
+		t.Fatalf("%d concurrent reserves succeeded, want 1", ok)
+	}
+}
+
+// 发放上限只能被并发的申请占用一次
+func TestReserveBudgetConcurrently(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10", HourlyCap: big.NewInt(10)})
+	now := time.Now()
+	ok := reserveConcurrently(20, func(i int) error {
+		_, err := db.ReserveIP(testAddress, "203.0.113.7", "api", now)
+		return err
+	})
+	if ok != 1 {
+		t.Fatalf("%d concurrent reserves succeeded, want 1", ok)
+	}
+}
+
+// Release 恢复地址和用户的申请间隔，并退回占用的发放额度
+func TestReleaseRestoresCooldownAndBudget(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10", AddressInterval: time.Hour, UserInterval: time.Hour, UserDailyQuota: 1})
+	now := time.Now()
+	claim, err := db.Reserve(testAddress, "user", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Reserve(testAddress, "user", now); err == nil {
+		t.Fatal("second claim should be limited")
+	}
+	usage, err := db.BudgetUsage(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.HourSpent.Cmp(big.NewInt(10)) != 0 {
+		t.Fatalf("hour spent = %s, want 10", usage.HourSpent)
+	}
+
+	if err = db.Release(claim.ID, "send error"); err != nil {
+		t.Fatal(err)
+	}
+	if usage, err = db.BudgetUsage(now); err != nil {
+		t.Fatal(err)
+	}
+	if usage.HourSpent.Sign() != 0 || usage.DaySpent.Sign() != 0 {
+		t.Fatalf("budget not refunded: hour %s, day %s", usage.HourSpent, usage.DaySpent)
+	}
+	record, err := db.GetClaim(claim.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != StatusFailed {
+		t.Fatalf("status = %s, want %s", record.Status, StatusFailed)
+	}
+	if _, err = db.Reserve(testAddress, "user", now); err != nil {
+		t.Fatalf("claim after release should succeed: %v", err)
+	}
+}
+
+// Release 最近的申请时，地址、用户和ip的最近申请恢复为上一次申请
+func TestReleaseRestoresPreviousClaim(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10", AddressInterval: time.Hour, UserInterval: time.Hour, IPInterval: time.Hour})
+	start := time.Now()
+	first, err := db.Reserve(testAddress, "user", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := db.Reserve(testAddress, "user", start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Release(second.ID, "send error"); err != nil {
+		t.Fatal(err)
+	}
+	addr, err := db.GetAddress(testAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.LastClaimID != first.ID || !addr.LastClaimAt.Equal(first.CreatedAt) || addr.Claims != 1 {
+		t.Fatalf("address record = %+v, want last claim %d", addr, first.ID)
+	}
+	user, err := db.GetUser("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.LastClaimID != first.ID || user.Claims != 1 {
+		t.Fatalf("user record = %+v, want last claim %d", user, first.ID)
+	}
+
+	// 最后一次申请也被释放后删除记录
+	if err = db.Release(first.ID, "send error"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.GetAddress(testAddress); err != ErrNotFound {
+		t.Fatalf("address record after releasing all claims: %v", err)
+	}
+	if _, err = db.GetUser("user"); err != ErrNotFound {
+		t.Fatalf("user record after releasing all claims: %v", err)
+	}
+
+	ipFirst, err := db.ReserveIP(otherAddress, "203.0.113.7", ChannelAPI, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipSecond, err := db.ReserveIP(testAddress, "203.0.113.7", ChannelAPI, start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Release(ipSecond.ID, "send error"); err != nil {
+		t.Fatal(err)
+	}
+	ip, err := db.GetIP("203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.LastClaimID != ipFirst.ID {
+		t.Fatalf("ip record = %+v, want last claim %d", ip, ipFirst.ID)
+	}
+}
+
+// 运维重置申请间隔后释放更新的申请，不恢复重置之前的申请间隔
+func TestReleaseKeepsCooldownReset(t *testing.T) {
+	db := openTestStore(t, Policy{Amount: "10", AddressInterval: time.Hour, UserInterval: time.Hour, UserDailyQuota: 1})
+	if _, err := db.Reserve(testAddress, "user", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ResetCooldown(TargetAddress, testAddress); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ResetCooldown(TargetOpenID, "user"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	claim, err := db.Reserve(testAddress, "user", now)
+	if err != nil {
+		t.Fatalf("claim after reset should succeed: %v", err)
+	}
+	if err = db.Release(claim.ID, "send error"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Reserve(testAddress, "user", now); err != nil {
+		t.Fatalf("released claim brought back the reset cooldown: %v", err)
+	}
+}
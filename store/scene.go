@@ -0,0 +1,136 @@
+package store
+
+import (
+	"github.com/boltdb/bolt"
+	"sort"
+	"time"
+)
+
+// 用户扫码进入公众号的推广渠道，key = 微信用户的openid, value = SceneRecord
+var sceneBucket = []byte("scenes")
+
+// SceneRecord 微信用户扫带参数的二维码进入公众号的记录
+type SceneRecord struct {
+	OpenID    string    `json:"openid"`
+	Scene     string    `json:"scene"` // 第一次扫码的场景值，即带来这个用户的渠道
+	FirstAt   time.Time `json:"firstAt"`
+	LastScene string    `json:"lastScene"` // 最近一次扫码的场景值，之后的申请都算在这个渠道上
+	LastAt    time.Time `json:"lastAt"`
+	Scans     uint64    `json:"scans"`
+}
+
+// SceneStats 一个推广渠道带来的用户和申请
+type SceneStats struct {
+	Scene      string `json:"scene"`
+	Users      uint64 `json:"users"`      // 第一次扫码来自这个渠道的用户数
+	Scans      uint64 `json:"scans"`      // 最近一次扫码来自这个渠道的用户数
+	Claims     uint64 `json:"claims"`     // 来自这个渠道的申请数，不包括失败和过期的申请
+	ClaimUsers uint64 `json:"claimUsers"` // 来自这个渠道申请过测试币的用户数
+	Confirmed  uint64 `json:"confirmed"`  // 来自这个渠道已经到账的申请数
+}
+
+// RecordScene 记录用户扫码的场景值，第一次扫码的场景值不会被覆盖
+func (s *Store) RecordScene(openid, scene string, now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		scenes := tx.Bucket(sceneBucket)
+		record := &SceneRecord{OpenID: openid, Scene: scene, FirstAt: now}
+		if err := getJSON(scenes, []byte(openid), record); err != nil && err != ErrNotFound {
+			return err
+		}
+		record.LastScene = scene
+		record.LastAt = now
+		record.Scans++
+		return putJSON(scenes, []byte(openid), record)
+	})
+}
+
+// GetScene 获取用户扫码的记录，没有扫过带参数的二维码返回ErrNotFound
+func (s *Store) GetScene(openid string) (*SceneRecord, error) {
+	record := new(SceneRecord)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(sceneBucket), []byte(openid), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// claimScene 申请所属的推广渠道，为用户最近一次扫码的场景值
+func claimScene(tx *bolt.Tx, openid string) (string, error) {
+	if openid == "" {
+		return "", nil
+	}
+	record := new(SceneRecord)
+	err := getJSON(tx.Bucket(sceneBucket), []byte(openid), record)
+	if err == ErrNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return record.LastScene, nil
+}
+
+// SceneStats 按推广渠道统计用户和申请，按用户数从多到少排序
+func (s *Store) SceneStats() ([]*SceneStats, error) {
+	stats := make(map[string]*SceneStats)
+	get := func(scene string) *SceneStats {
+		if stats[scene] == nil {
+			stats[scene] = &SceneStats{Scene: scene}
+		}
+		return stats[scene]
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		scenes := tx.Bucket(sceneBucket)
+		err := scenes.ForEach(func(k, _ []byte) error {
+			record := new(SceneRecord)
+			if err := getJSON(scenes, k, record); err != nil {
+				return err
+			}
+			get(record.Scene).Users++
+			get(record.LastScene).Scans++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		claimUsers := make(map[string]map[string]bool)
+		claims := tx.Bucket(claimBucket)
+		return claims.ForEach(func(k, _ []byte) error {
+			record := new(ClaimRecord)
+			if err := getJSON(claims, k, record); err != nil {
+				return err
+			}
+			if record.Scene == "" || record.Status == StatusFailed || record.Status == StatusExpired {
+				return nil
+			}
+			stat := get(record.Scene)
+			stat.Claims++
+			if record.Status == StatusConfirmed {
+				stat.Confirmed++
+			}
+			if claimUsers[record.Scene] == nil {
+				claimUsers[record.Scene] = make(map[string]bool)
+			}
+			if !claimUsers[record.Scene][record.OpenID] {
+				claimUsers[record.Scene][record.OpenID] = true
+				stat.ClaimUsers++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*SceneStats, 0, len(stats))
+	for _, stat := range stats {
+		list = append(list, stat)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Users != list[j].Users {
+			return list[i].Users > list[j].Users
+		}
+		return list[i].Scene < list[j].Scene
+	})
+	return list, nil
+}
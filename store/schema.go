@@ -0,0 +1,134 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// 当前db的schema版本，每次修改存储格式都要加1并在migrations中增加对应的迁移函数
+const schemaVersion = 2
+
+var (
+	metaBucket       = []byte("meta")
+	claimBucket      = []byte("claims")    // key = 申请id, value = ClaimRecord
+	addressBucket    = []byte("addresses") // key = 大写的LemoAddress, value = AddressRecord
+	userBucket       = []byte("users")     // key = 微信用户的openid, value = UserRecord
+	legacyBucket     = []byte("bucket")    // 版本0: key = 大写的LemoAddress, value = 十进制的tx.Expiration
+	schemaVersionKey = []byte("version")
+)
+
+// 版本0中存储的是交易的过期时间，交易过期时间为申请时间加上30分钟
+const legacyExpiration = 30 * 60
+
+// 版本1中已经发送给节点的交易的状态，版本2改为StatusPending
+const legacyStatusSent ClaimStatus = "sent"
+
+// migrations[i] 把版本i的数据迁移到版本i+1
+var migrations = []func(tx *bolt.Tx) error{
+	migrateLegacyBucket,
+	migrateSentToPending,
+}
+
+// migrate 创建当前版本需要的表，并依次执行未执行过的迁移
+func (s *Store) migrate(tx *bolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	var version uint64
+	if v := meta.Get(schemaVersionKey); v != nil {
+		version = btoi(v)
+	}
+	if version > schemaVersion {
+		return fmt.Errorf("db schema version %d is newer than supported version %d", version, schemaVersion)
+	}
+	for _, name := range [][]byte{claimBucket, addressBucket, userBucket, budgetBucket, queueBucket, pendingBucket, sceneBucket, tagQueueBucket, taggedBucket, templateBucket, templateMsgBucket, ipBucket, challengeBucket, listBucket, listAuditBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+	for ; version < schemaVersion; version++ {
+		log.Printf("migrate db schema from version %d to %d\n", version, version+1)
+		if err := migrations[version](tx); err != nil {
+			return err
+		}
+		if err := meta.Put(schemaVersionKey, itob(version+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateLegacyBucket 把版本0的"bucket"表中的地址和过期时间转换为申请记录，然后删除旧表
+func migrateLegacyBucket(tx *bolt.Tx) error {
+	legacy := tx.Bucket(legacyBucket)
+	if legacy == nil {
+		return nil
+	}
+	claims := tx.Bucket(claimBucket)
+	addresses := tx.Bucket(addressBucket)
+	err := legacy.ForEach(func(k, v []byte) error {
+		expiration, err := strconv.ParseUint(string(v), 10, 64)
+		if err != nil {
+			log.Printf("skip legacy record %s: %v\n", k, err)
+			return nil
+		}
+		claimTime := time.Unix(int64(expiration)-legacyExpiration, 0)
+		id, err := claims.NextSequence()
+		if err != nil {
+			return err
+		}
+		record := &ClaimRecord{
+			ID:        id,
+			Address:   string(k),
+			Status:    legacyStatusSent,
+			CreatedAt: claimTime,
+			UpdatedAt: claimTime,
+		}
+		if err := putJSON(claims, itob(id), record); err != nil {
+			return err
+		}
+		return putJSON(addresses, k, &AddressRecord{
+			Address:     string(k),
+			LastClaimID: id,
+			LastClaimAt: claimTime,
+			Claims:      1,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return tx.DeleteBucket(legacyBucket)
+}
+
+// migrateSentToPending 把版本1中状态为sent的申请改为pending，并加入等待确认的列表
+func migrateSentToPending(tx *bolt.Tx) error {
+	claims := tx.Bucket(claimBucket)
+	pending := tx.Bucket(pendingBucket)
+	return claims.ForEach(func(k, v []byte) error {
+		record := new(ClaimRecord)
+		if err := json.Unmarshal(v, record); err != nil {
+			return err
+		}
+		if record.Status != legacyStatusSent {
+			return nil
+		}
+		if record.Attempts == 0 {
+			record.Attempts = 1
+		}
+		// 版本0迁移过来的申请没有交易hash，无法再确认，视为已经上链
+		if record.TxHash == "" {
+			record.Status = StatusConfirmed
+			return putJSON(claims, k, record)
+		}
+		record.Status = StatusPending
+		if err := pending.Put(k, nil); err != nil {
+			return err
+		}
+		return putJSON(claims, k, record)
+	})
+}
@@ -0,0 +1,22 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testAddress  = "Lemo83W7HDZYS33Z745NZ2FGF37565DSF5AHJZ4J"
+	otherAddress = "Lemo8P6NS3HR7ZTRJ6Z6YZ3WG3ZRK5ZB2P4RTQ6N"
+)
+
+// openTestStore 在临时目录打开数据库并设置发放策略，测试结束时关闭
+func openTestStore(t *testing.T, p Policy) *Store {
+	db, err := Open(filepath.Join(t.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetPolicy(p)
+	return db
+}
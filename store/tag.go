@@ -0,0 +1,78 @@
+package store
+
+import (
+	"bytes"
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+var (
+	tagQueueBucket = []byte("tagQueue") // 等待打标签的用户，key = 8字节的标签id + openid, value = 加入队列的时间
+	taggedBucket   = []byte("tagged")   // 已经打过标签的用户，key = 8字节的标签id + openid, value = 打标签的时间
+)
+
+func tagKey(tagId int, openid string) []byte {
+	return append(itob(uint64(tagId)), openid...)
+}
+
+// QueueTag 把给用户打标签加入队列，已经打过或者已经在队列中时返回false
+func (s *Store) QueueTag(tagId int, openid string, now time.Time) (bool, error) {
+	queued := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		key := tagKey(tagId, openid)
+		if tx.Bucket(taggedBucket).Get(key) != nil || tx.Bucket(tagQueueBucket).Get(key) != nil {
+			return nil
+		}
+		queued = true
+		return tx.Bucket(tagQueueBucket).Put(key, itob(uint64(now.Unix())))
+	})
+	return queued, err
+}
+
+// QueuedTags 返回队列中第一个标签和最多limit个等待打这个标签的用户，队列为空时返回的用户为空
+func (s *Store) QueuedTags(limit int) (int, []string, error) {
+	var tagId int
+	var openids []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(tagQueueBucket).Cursor()
+		k, _ := c.First()
+		if k == nil {
+			return nil
+		}
+		prefix := k[:8]
+		tagId = int(btoi(prefix))
+		for ; k != nil && bytes.HasPrefix(k, prefix) && len(openids) < limit; k, _ = c.Next() {
+			openids = append(openids, string(k[8:]))
+		}
+		return nil
+	})
+	return tagId, openids, err
+}
+
+// MarkTagged 打标签成功，移出队列并记录，之后不会再给这些用户打这个标签
+func (s *Store) MarkTagged(tagId int, openids []string, now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, openid := range openids {
+			key := tagKey(tagId, openid)
+			if err := tx.Bucket(tagQueueBucket).Delete(key); err != nil {
+				return err
+			}
+			if err := tx.Bucket(taggedBucket).Put(key, itob(uint64(now.Unix()))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DropTags 打标签失败并且不能重试，移出队列，之后可以重新加入队列
+func (s *Store) DropTags(tagId int, openids []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, openid := range openids {
+			if err := tx.Bucket(tagQueueBucket).Delete(tagKey(tagId, openid)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
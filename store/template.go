@@ -0,0 +1,92 @@
+package store
+
+import (
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+var (
+	templateBucket    = []byte("templates")    // 到账通知的模板消息，key = 申请id, value = TemplateRecord
+	templateMsgBucket = []byte("templateMsgs") // 模板消息id到申请id的索引，key = 8字节的消息id, value = 申请id
+)
+
+// TemplateStatus 模板消息的送达状态
+type TemplateStatus string
+
+const (
+	TemplateSent    TemplateStatus = "sent"    // 已经调用发送接口，等待微信推送发送结果
+	TemplateError   TemplateStatus = "error"   // 调用发送接口失败
+	TemplateSuccess TemplateStatus = "success" // 送达用户
+	TemplateBlocked TemplateStatus = "blocked" // 用户拒收公众号的消息
+	TemplateFailed  TemplateStatus = "failed"  // 其他原因发送失败
+)
+
+// TemplateRecord 一个申请的到账通知模板消息
+type TemplateRecord struct {
+	ClaimID    uint64         `json:"claimId"`
+	OpenID     string         `json:"openid"`
+	MsgID      int64          `json:"msgId,omitempty"`
+	Status     TemplateStatus `json:"status"`
+	Error      string         `json:"error,omitempty"` // 发送失败的原因
+	SentAt     time.Time      `json:"sentAt"`
+	FinishedAt time.Time      `json:"finishedAt"` // 收到微信推送的发送结果的时间
+}
+
+// RecordTemplate 记录申请的到账通知的发送结果，msgID为0表示调用发送接口失败
+func (s *Store) RecordTemplate(claimID uint64, openid string, msgID int64, sendErr error, now time.Time) error {
+	record := &TemplateRecord{ClaimID: claimID, OpenID: openid, MsgID: msgID, Status: TemplateSent, SentAt: now}
+	if sendErr != nil {
+		record.Status = TemplateError
+		record.Error = sendErr.Error()
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if msgID != 0 {
+			if err := tx.Bucket(templateMsgBucket).Put(itob(uint64(msgID)), itob(claimID)); err != nil {
+				return err
+			}
+		}
+		return putJSON(tx.Bucket(templateBucket), itob(claimID), record)
+	})
+}
+
+// FinishTemplate 收到微信推送的模板消息发送结果，status为推送中的Status，不是水龙头发送的消息返回ErrNotFound
+func (s *Store) FinishTemplate(msgID int64, status string, now time.Time) (*TemplateRecord, error) {
+	record := new(TemplateRecord)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		id := tx.Bucket(templateMsgBucket).Get(itob(uint64(msgID)))
+		if id == nil {
+			return ErrNotFound
+		}
+		templates := tx.Bucket(templateBucket)
+		if err := getJSON(templates, id, record); err != nil {
+			return err
+		}
+		switch status {
+		case "success":
+			record.Status = TemplateSuccess
+		case "failed:user block":
+			record.Status = TemplateBlocked
+		default:
+			record.Status = TemplateFailed
+			record.Error = status
+		}
+		record.FinishedAt = now
+		return putJSON(templates, id, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// GetTemplate 获取申请的到账通知，没有发送过返回ErrNotFound
+func (s *Store) GetTemplate(claimID uint64) (*TemplateRecord, error) {
+	record := new(TemplateRecord)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(templateBucket), itob(claimID), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
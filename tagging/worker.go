@@ -0,0 +1,185 @@
+// 按规则给微信用户打标签。满足规则的用户先加入store中的标签队列，
+// 后台按标签分批调用微信的批量打标签接口，每次最多50个用户
+package tagging
+
+import (
+	"github.com/lemoTestCoin/config"
+	"github.com/lemoTestCoin/manager"
+	"github.com/lemoTestCoin/store"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	pollInterval = 10 * time.Second // 队列为空时，最长多久检查一次队列
+	retryDelay   = time.Minute      // 接口调用失败后，等待多久再重试
+)
+
+// Rule 解析好的打标签规则
+type Rule struct {
+	TagId  int
+	Tag    string
+	Claims uint64 // 申请次数达到Claims次时打标签
+	Scene  string // 扫码的场景值为Scene时打标签
+}
+
+// ResolveRules 查找规则中的标签id，标签不存在时创建
+func ResolveRules(tokens *manager.TokenManager, confRules []config.TagRule) ([]Rule, error) {
+	tags, err := manager.ListTags(tokens)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int)
+	for _, tag := range tags {
+		ids[tag.Name] = tag.Id
+	}
+	rules := make([]Rule, 0, len(confRules))
+	for _, rule := range confRules {
+		id, ok := ids[rule.Tag]
+		if !ok {
+			if id, err = manager.CreateTag(tokens, rule.Tag); err != nil {
+				return nil, err
+			}
+			ids[rule.Tag] = id
+			log.Printf("tagging: create tag %s, id %d\n", rule.Tag, id)
+		}
+		rules = append(rules, Rule{TagId: id, Tag: rule.Tag, Claims: rule.Claims, Scene: rule.Scene})
+	}
+	return rules, nil
+}
+
+// Worker 单个goroutine按顺序处理标签队列
+type Worker struct {
+	db     *store.Store
+	tokens *manager.TokenManager
+	rules  []Rule
+
+	wake chan struct{}
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewWorker 创建打标签的worker
+func NewWorker(db *store.Store, tokens *manager.TokenManager, rules []Rule) *Worker {
+	return &Worker{
+		db:     db,
+		tokens: tokens,
+		rules:  rules,
+		wake:   make(chan struct{}, 1),
+		quit:   make(chan struct{}),
+	}
+}
+
+// Start 启动后台goroutine，上次退出时队列中的用户会继续处理
+func (w *Worker) Start() {
+	w.wg.Add(1)
+	go w.loop()
+}
+
+// Stop 等待正在调用的接口完成后退出
+func (w *Worker) Stop() {
+	close(w.quit)
+	w.wg.Wait()
+}
+
+// Wake 有新的用户加入队列时调用，立即处理队列
+func (w *Worker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ClaimConfirmed 用户申请的测试币到账，claims为用户的申请次数
+func (w *Worker) ClaimConfirmed(openid string, claims uint64) {
+	w.apply(openid, func(rule Rule) bool {
+		return rule.Claims > 0 && claims >= rule.Claims
+	})
+}
+
+// Scanned 用户扫了场景值为scene的二维码
+func (w *Worker) Scanned(openid, scene string) {
+	w.apply(openid, func(rule Rule) bool {
+		return rule.Scene != "" && rule.Scene == scene
+	})
+}
+
+// apply 把满足规则的标签加入队列
+func (w *Worker) apply(openid string, match func(rule Rule) bool) {
+	if openid == "" {
+		return
+	}
+	queued := false
+	for _, rule := range w.rules {
+		if !match(rule) {
+			continue
+		}
+		ok, err := w.db.QueueTag(rule.TagId, openid, time.Now())
+		if err != nil {
+			log.Printf("tagging: queue tag %s for %s error: %v\n", rule.Tag, openid, err)
+			continue
+		}
+		queued = queued || ok
+	}
+	if queued {
+		w.Wake()
+	}
+}
+
+func (w *Worker) loop() {
+	defer w.wg.Done()
+	for {
+		wait := w.processQueue()
+		select {
+		case <-w.quit:
+			return
+		case <-w.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// processQueue 处理队列中所有的用户，接口调用失败时返回需要等待的时间
+func (w *Worker) processQueue() time.Duration {
+	for {
+		select {
+		case <-w.quit:
+			return 0
+		default:
+		}
+		tagId, openids, err := w.db.QueuedTags(manager.MaxTagBatch)
+		if err != nil {
+			log.Println("tagging: read queue error:", err)
+			return retryDelay
+		}
+		if len(openids) == 0 {
+			return pollInterval
+		}
+		if !w.process(tagId, openids) {
+			return retryDelay
+		}
+	}
+}
+
+// process 给一批用户打标签，可以重试的错误返回false，稍后重试
+func (w *Worker) process(tagId int, openids []string) bool {
+	err := manager.AddTagForUser(w.tokens, openids, tagId)
+	if err == nil {
+		if err = w.db.MarkTagged(tagId, openids, time.Now()); err != nil {
+			log.Printf("tagging: mark tag %d error: %v\n", tagId, err)
+			return false
+		}
+		return true
+	}
+	if manager.IsRetryable(err) {
+		log.Printf("tagging: tag %d for %d users error, retry later: %v\n", tagId, len(openids), err)
+		return false
+	}
+	log.Printf("tagging: tag %d for %d users error, drop them: %v\n", tagId, len(openids), err)
+	if err = w.db.DropTags(tagId, openids); err != nil {
+		log.Printf("tagging: drop tag %d error: %v\n", tagId, err)
+		return false
+	}
+	return true
+}
@@ -1,138 +1,104 @@
 package types
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/ecdsa"
 	"fmt"
 	"github.com/lemoTestCoin/common"
 	"github.com/lemoTestCoin/common/crypto"
-	"github.com/lemoTestCoin/store"
-	"io/ioutil"
+	"github.com/lemoTestCoin/config"
 	"log"
 	"math/big"
-	"net/http"
 	"time"
 )
 
 const (
 	defaultGasPrice = 1e9
 	defaultGasLimit = 50000
-	chainID         = 100
-	chainUrl        = "http://47.99.139.137:8001" // 连接一个节点的ip地址
-	// chainUrl = "http://127.0.0.1:8001"
 )
 
-var senderLemoAddress = "Lemo83GN72GYH2NZ8BA729Z9TCT7KQ5FC3CR6DJG"
-var SenderToPrivate, _ = crypto.HexToECDSA("c21b6b2fbf230f665b936194d14da67187732bf9d28768aef1a3cbb26608f8aa")
-var from, _ = common.StringToAddress(senderLemoAddress)
+var (
+	chainID         uint16
+	nodes           *NodePool // 连接的节点
+	SenderToPrivate *ecdsa.PrivateKey
+	from            common.Address
+)
 
-// 与glemo交互发送交易
-func SendCoin(content string, amount uint64) (error, string) {
+// Init 使用配置初始化链的连接参数和打币账户，必须在SendCoin和GetBalance之前调用。
+// private为已经解锁的打币账户私钥，如果配置了SenderAddress则必须与私钥对应
+func Init(conf *config.ChainConfig, private *ecdsa.PrivateKey) error {
+	sender := crypto.PubkeyToAddress(private.PublicKey)
+	if conf.SenderAddress != "" {
+		address, err := common.StringToAddress(conf.SenderAddress)
+		if err != nil {
+			return fmt.Errorf("invalid sender address: %v", err)
+		}
+		if address != sender {
+			return fmt.Errorf("sender private key does not match address %s", conf.SenderAddress)
+		}
+	}
+	chainID = conf.ChainID
+	nodes = NewNodePool(conf.NodeUrls, time.Duration(conf.Timeout)*time.Second)
+	nodes.Start(time.Duration(conf.HealthInterval) * time.Second)
+	SenderToPrivate = private
+	from = sender
+	return nil
+}
+
+// 与glemo交互发送交易，expiration为交易的过期时间(unix秒)。
+// 交易签名之后发送失败时仍返回本地计算的交易hash，超时等错误时节点可能已经收到了交易
+func SendCoin(content string, amount *big.Int, expiration uint64) (error, string) {
 	to, err := common.StringToAddress(content)
 	if err != nil {
 		log.Println("decode address error:", err)
 		return err, ""
 	}
 	// 生成交易
-	wxTx := NewTransaction(from, to, new(big.Int).SetUint64(amount), defaultGasLimit, new(big.Int).SetUint64(defaultGasPrice), []byte{}, 0, chainID, uint64(time.Now().Unix()+30*60), "wx", "water faucet")
+	wxTx := NewTransaction(from, to, amount, defaultGasLimit, new(big.Int).SetUint64(defaultGasPrice), []byte{}, 0, chainID, expiration, "wx", "water faucet")
 	// 签名交易
 	signWxTx := SignTransaction(wxTx, SenderToPrivate)
-	txData, err := signWxTx.MarshalJSON()
-	fmt.Println(string(txData))
-	if err != nil {
-		log.Println("tx marshal failed:", err)
-		return err, ""
-	}
-	// jsonData := []byte(`{"jsonrpc": "2.0","method": "tx_sendTx","params": [],"id": 1}`)
-	data := &PostData{
-		Version: "2.0",
-		Id:      1,
-		Method:  "tx_sendTx",
-		Payload: []json.RawMessage{txData},
-	}
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Println("marshal error:", err)
-		return err, ""
-	}
-	fmt.Println(string(jsonData))
-	reader := bytes.NewReader(jsonData)
-	// post
-	resp, err := http.Post(chainUrl, "application/json;charset=UTF-8", reader)
-	if err != nil {
-		log.Println("post error:", err)
-		return err, ""
-	}
-	// 记录用户成功发起申请交易的时间到db
-	err = store.Putdb(content, wxTx.data.Expiration)
-	if err != nil {
-		log.Println("put tx time to db error:", err)
-		return err, ""
-	}
-
-	respTx, err := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	if err != nil {
-		log.Println("glemo response error:", err)
-		return err, ""
-	}
-	respon := &jsonSuccessResponse{}
-
-	err = json.Unmarshal(respTx, respon)
+	var txHash string
+	err = nodes.Send(func(c *Client) error {
+		txHash, err = c.SendTx(context.Background(), signWxTx)
+		return err
+	})
 	if err != nil {
-		log.Println("json.Unmarshal response error:", err)
-		return err, ""
+		log.Println("send tx error:", err)
+		return err, signWxTx.Hash().Hex()
 	}
-	return nil, respon.Result.(string)
+	return nil, txHash
 }
 
-type PostData struct {
-	Version string            `json:"jsonrpc"`
-	Id      uint64            `json:"id"`
-	Method  string            `json:"method"`
-	Payload []json.RawMessage `json:"params,omitempty"`
-}
-type jsonSuccessResponse struct {
-	Version string      `json:"jsonrpc"`
-	Id      uint64      `json:"id"`
-	Result  interface{} `json:"result"`
+// 根据交易hash查询交易，节点中没有此交易时返回nil
+func GetTxByHash(txHash string) (*TxInfo, error) {
+	var info *TxInfo
+	err := nodes.Read(func(c *Client) (err error) {
+		info, err = c.GetTxByHash(context.Background(), txHash)
+		return err
+	})
+	return info, err
 }
 
 // 查询用户账户余额
 func GetBalance(lemoAddress string) (string, error) {
-
-	jsonlemoAdd, err := json.Marshal(lemoAddress)
-	if err != nil {
-		log.Println("json 102 marshal error:", err)
-	}
-	data := PostData{
-		Version: "2.0",
-		Id:      1,
-		Method:  "account_getBalance",
-		Payload: []json.RawMessage{jsonlemoAdd},
-	}
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Println("json 112 marshal error:", err)
-		return "", err
-	}
-	reader := bytes.NewReader(jsonData)
-	resp, err := http.Post(chainUrl, "application/json;charset=UTF-8", reader)
+	var balance string
+	err := nodes.Read(func(c *Client) (err error) {
+		balance, err = c.GetBalance(context.Background(), lemoAddress)
+		return err
+	})
 	if err != nil {
-		log.Println("post error:", err)
+		log.Println("get balance error:", err)
 		return "", err
 	}
-	byteResp, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Println("read response error:", err)
-		return "", err
-	}
-	defer resp.Body.Close()
-	respon := new(jsonSuccessResponse)
-	err = json.Unmarshal(byteResp, respon)
-	if err != nil {
-		log.Println("unmarshal error:", err)
-		return "", nil
-	}
-	return respon.Result.(string), nil
+	return balance, nil
+}
+
+// GetNodeStats 返回所有节点的状态和请求统计
+func GetNodeStats() []NodeStats {
+	return nodes.Stats()
+}
+
+// SenderAddress 打币账户的Lemo地址
+func SenderAddress() string {
+	return from.String()
 }
@@ -0,0 +1,223 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultHealthInterval = 30 * time.Second // 默认的节点健康检查间隔
+	maxHeightLag          = 10               // 节点高度落后最高节点超过这个值视为未同步
+)
+
+var ErrNoHealthyNode = errors.New("no healthy lemochain node")
+
+// NodeStats 节点的状态和请求统计，提供给运维查看
+type NodeStats struct {
+	Url       string    `json:"url"`
+	Primary   bool      `json:"primary"` // 发送交易使用的节点
+	Healthy   bool      `json:"healthy"`
+	Height    uint32    `json:"height"`
+	Requests  uint64    `json:"requests"`
+	Errors    uint64    `json:"errors"`
+	LastError string    `json:"lastError,omitempty"`
+	LastCheck time.Time `json:"lastCheck"`
+}
+
+type node struct {
+	client *Client
+
+	requests uint64
+	errors   uint64
+
+	mu        sync.Mutex
+	healthy   bool
+	height    uint32
+	lastError string
+	lastCheck time.Time
+}
+
+func (n *node) isHealthy() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.healthy
+}
+
+// record 记录一次请求的结果，网络错误时把节点标记为不健康，等待下一次健康检查恢复
+func (n *node) record(err error) {
+	atomic.AddUint64(&n.requests, 1)
+	if err == nil {
+		return
+	}
+	atomic.AddUint64(&n.errors, 1)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lastError = err.Error()
+	if _, ok := err.(*RPCError); !ok && err != ErrNullResult {
+		n.healthy = false
+	}
+}
+
+// NodePool 管理多个节点，定时检查节点高度，读请求在健康的节点之间轮询，
+// 发送交易固定使用主节点，主节点不可用时切换到下一个健康的节点
+type NodePool struct {
+	nodes   []*node
+	primary int32  // 主节点下标
+	next    uint32 // 读请求轮询的计数
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewNodePool 创建节点池，urls中第一个节点为初始的主节点，节点初始状态为健康
+func NewNodePool(urls []string, timeout time.Duration) *NodePool {
+	p := &NodePool{quit: make(chan struct{})}
+	for _, url := range urls {
+		p.nodes = append(p.nodes, &node{client: NewClient(url, timeout), healthy: true})
+	}
+	return p
+}
+
+// Start 启动定时健康检查
+func (p *NodePool) Start(interval time.Duration) {
+	if interval == 0 {
+		interval = DefaultHealthInterval
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.checkHealth()
+			select {
+			case <-p.quit:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止健康检查
+func (p *NodePool) Stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+// checkHealth 查询所有节点的当前高度，请求失败或者高度落后太多的节点为不健康
+func (p *NodePool) checkHealth() {
+	heights := make([]uint32, len(p.nodes))
+	errs := make([]error, len(p.nodes))
+	var wg sync.WaitGroup
+	for i, n := range p.nodes {
+		wg.Add(1)
+		go func(i int, n *node) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultRPCTimeout)
+			defer cancel()
+			heights[i], errs[i] = n.client.CurrentHeight(ctx)
+		}(i, n)
+	}
+	wg.Wait()
+
+	var best uint32
+	for i := range p.nodes {
+		if errs[i] == nil && heights[i] > best {
+			best = heights[i]
+		}
+	}
+	now := time.Now()
+	for i, n := range p.nodes {
+		n.mu.Lock()
+		n.lastCheck = now
+		if errs[i] != nil {
+			n.healthy = false
+			n.lastError = errs[i].Error()
+		} else {
+			n.height = heights[i]
+			n.healthy = best-heights[i] <= maxHeightLag
+		}
+		healthy := n.healthy
+		n.mu.Unlock()
+		if !healthy {
+			log.Printf("lemochain node %s is unhealthy, height %d, best %d, error %v\n", n.client.Url(), heights[i], best, errs[i])
+		}
+	}
+	p.primaryNode()
+}
+
+// primaryNode 返回主节点，主节点不健康时切换到下一个健康的节点，所有节点都不健康时仍返回原来的主节点
+func (p *NodePool) primaryNode() *node {
+	current := int(atomic.LoadInt32(&p.primary))
+	for i := 0; i < len(p.nodes); i++ {
+		idx := (current + i) % len(p.nodes)
+		if p.nodes[idx].isHealthy() {
+			if idx != current && atomic.CompareAndSwapInt32(&p.primary, int32(current), int32(idx)) {
+				log.Printf("switch primary lemochain node from %s to %s\n", p.nodes[current].client.Url(), p.nodes[idx].client.Url())
+			}
+			return p.nodes[idx]
+		}
+	}
+	return p.nodes[current]
+}
+
+// Send 在主节点上执行发送交易的请求，网络错误时切换主节点重试一次。
+// 同一笔已签名交易的hash不变，重复发送不会重复打币
+func (p *NodePool) Send(fn func(*Client) error) error {
+	n := p.primaryNode()
+	err := fn(n.client)
+	n.record(err)
+	if err == nil || n.isHealthy() {
+		return err
+	}
+	if retry := p.primaryNode(); retry != n {
+		err = fn(retry.client)
+		retry.record(err)
+	}
+	return err
+}
+
+// Read 在健康的节点之间轮询执行读请求，失败时换下一个节点重试
+func (p *NodePool) Read(fn func(*Client) error) error {
+	start := int(atomic.AddUint32(&p.next, 1))
+	err := ErrNoHealthyNode
+	for i := 0; i < len(p.nodes); i++ {
+		n := p.nodes[(start+i)%len(p.nodes)]
+		if !n.isHealthy() {
+			continue
+		}
+		err = fn(n.client)
+		n.record(err)
+		// 节点返回的rpc错误换节点也一样，不再重试
+		if _, ok := err.(*RPCError); ok || err == nil || err == ErrNullResult {
+			return err
+		}
+	}
+	return err
+}
+
+// Stats 返回所有节点的状态
+func (p *NodePool) Stats() []NodeStats {
+	primary := int(atomic.LoadInt32(&p.primary))
+	stats := make([]NodeStats, 0, len(p.nodes))
+	for i, n := range p.nodes {
+		n.mu.Lock()
+		stats = append(stats, NodeStats{
+			Url:       n.client.Url(),
+			Primary:   i == primary,
+			Healthy:   n.healthy,
+			Height:    n.height,
+			Requests:  atomic.LoadUint64(&n.requests),
+			Errors:    atomic.LoadUint64(&n.errors),
+			LastError: n.lastError,
+			LastCheck: n.lastCheck,
+		})
+		n.mu.Unlock()
+	}
+	return stats
+}
@@ -0,0 +1,119 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// downUrl 返回一个已经关闭的节点地址，请求会返回连接错误
+func downUrl() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL
+}
+
+// countingServer 返回result的测试节点，calls记录收到的请求数
+func countingServer(t *testing.T, calls *int32, result string) string {
+	return newRPCServer(t, func(id uint64) string {
+		atomic.AddInt32(calls, 1)
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,%s}`, id, result)
+	}).URL
+}
+
+func callTest(c *Client) error {
+	var result string
+	return c.Call(context.Background(), &result, "chain_test")
+}
+
+// 主节点连接失败时切换到下一个健康的节点重新发送
+func TestSendFailsOverWhenPrimaryDown(t *testing.T) {
+	var calls int32
+	pool := NewNodePool([]string{downUrl(), countingServer(t, &calls, `"result":"0x01"`)}, time.Second)
+	if err := pool.Send(callTest); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("backup node received %d requests, want 1", calls)
+	}
+	stats := pool.Stats()
+	if stats[0].Healthy || stats[0].Primary || !stats[1].Primary {
+		t.Fatalf("stats after failover: %+v", stats)
+	}
+	// 之后的交易直接发送到新的主节点
+	if err := pool.Send(callTest); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("backup node received %d requests, want 2", calls)
+	}
+}
+
+// 节点返回的rpc错误不会让节点变为不健康，也不会切换主节点
+func TestSendKeepsPrimaryOnRPCError(t *testing.T) {
+	var primaryCalls, backupCalls int32
+	pool := NewNodePool([]string{
+		countingServer(t, &primaryCalls, `"error":{"code":-32000,"message":"nonce too low"}`),
+		countingServer(t, &backupCalls, `"result":"0x01"`),
+	}, time.Second)
+	if _, ok := pool.Send(callTest).(*RPCError); !ok {
+		t.Fatal("send should return the rpc error of the primary node")
+	}
+	if primaryCalls != 1 || backupCalls != 0 {
+		t.Fatalf("primary received %d requests, backup %d", primaryCalls, backupCalls)
+	}
+	if stats := pool.Stats(); !stats[0].Primary || !stats[0].Healthy {
+		t.Fatalf("stats after rpc error: %+v", stats)
+	}
+}
+
+// 读请求跳过连接失败的节点，遇到rpc错误时不再换节点重试
+func TestRead(t *testing.T) {
+	var calls int32
+	pool := NewNodePool([]string{downUrl(), countingServer(t, &calls, `"result":"0x01"`)}, time.Second)
+	for i := 0; i < 2; i++ {
+		if err := pool.Read(callTest); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+	}
+
+	var first, second int32
+	pool = NewNodePool([]string{
+		countingServer(t, &first, `"error":{"code":-32602,"message":"invalid params"}`),
+		countingServer(t, &second, `"error":{"code":-32602,"message":"invalid params"}`),
+	}, time.Second)
+	if _, ok := pool.Read(callTest).(*RPCError); !ok {
+		t.Fatal("read should return the rpc error")
+	}
+	if first+second != 1 {
+		t.Fatalf("rpc error retried on %d nodes", first+second)
+	}
+
+	pool = NewNodePool([]string{downUrl(), downUrl()}, time.Second)
+	pool.Read(callTest) // 连接失败后两个节点都标记为不健康
+	if err := pool.Read(callTest); err != ErrNoHealthyNode {
+		t.Fatalf("read without healthy nodes returned %v, want %v", err, ErrNoHealthyNode)
+	}
+}
+
+// 高度落后太多的节点为不健康，主节点切换到同步的节点
+func TestCheckHealth(t *testing.T) {
+	height := func(h int) string {
+		return newRPCServer(t, func(id uint64) string {
+			return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":%d}`, id, h)
+		}).URL
+	}
+	pool := NewNodePool([]string{height(100), height(200), downUrl()}, time.Second)
+	pool.checkHealth()
+	stats := pool.Stats()
+	if stats[0].Healthy || !stats[1].Healthy || stats[2].Healthy {
+		t.Fatalf("health after check: %+v", stats)
+	}
+	if !stats[1].Primary || stats[1].Height != 200 {
+		t.Fatalf("primary after check: %+v", stats)
+	}
+}
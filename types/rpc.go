@@ -0,0 +1,136 @@
+package types
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	jsonrpcVersion = "2.0"
+	contentType    = "application/json;charset=UTF-8"
+
+	// DefaultRPCTimeout 单个rpc请求的默认超时时间
+	DefaultRPCTimeout = 10 * time.Second
+)
+
+var (
+	ErrNullResult = errors.New("rpc result is null")
+	errIdMismatch = errors.New("rpc response id does not match request id")
+)
+
+// RPCError 节点返回的json-rpc错误对象
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	if len(e.Data) > 0 {
+		return fmt.Sprintf("rpc error %d: %s (%s)", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// jsonrpc请求
+type jsonRequest struct {
+	Version string            `json:"jsonrpc"`
+	Id      uint64            `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+// jsonrpc响应，Result和Error只有一个不为空
+type jsonResponse struct {
+	Version string          `json:"jsonrpc"`
+	Id      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// Client 连接一个lemochain节点的json-rpc客户端，可以被多个goroutine并发使用
+type Client struct {
+	url  string
+	http *http.Client
+	seq  uint64 // 请求id，每次请求加1
+}
+
+// NewClient 创建连接到url的客户端，timeout为单个请求的超时时间，0表示使用默认值
+func NewClient(url string, timeout time.Duration) *Client {
+	if timeout == 0 {
+		timeout = DefaultRPCTimeout
+	}
+	return &Client{
+		url:  url,
+		http: &http.Client{Timeout: timeout},
+	}
+}
+
+// Url 节点地址
+func (c *Client) Url() string {
+	return c.url
+}
+
+// Call 调用节点的method方法，把结果反序列化到result中，result为nil时忽略结果。
+// 节点返回错误对象时返回*RPCError
+func (c *Client) Call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	req := &jsonRequest{
+		Version: jsonrpcVersion,
+		Id:      atomic.AddUint64(&c.seq, 1),
+		Method:  method,
+		Params:  make([]json.RawMessage, 0, len(args)),
+	}
+	for _, arg := range args {
+		param, err := json.Marshal(arg)
+		if err != nil {
+			return err
+		}
+		req.Params = append(req.Params, param)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	resp, err := c.http.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc http status %s: %s", resp.Status, respBody)
+	}
+
+	respon := new(jsonResponse)
+	if err = json.Unmarshal(respBody, respon); err != nil {
+		return fmt.Errorf("invalid rpc response: %v", err)
+	}
+	if respon.Error != nil {
+		return respon.Error
+	}
+	if respon.Id != req.Id {
+		return errIdMismatch
+	}
+	if result == nil {
+		return nil
+	}
+	if len(respon.Result) == 0 || string(respon.Result) == "null" {
+		return ErrNullResult
+	}
+	return json.Unmarshal(respon.Result, result)
+}
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// TxInfo 节点中的交易信息
+type TxInfo struct {
+	Tx        json.RawMessage `json:"tx"`
+	IsPending bool            `json:"isPending"` // true表示交易还在交易池中，没有打包进区块
+	Height    uint32          `json:"height"`
+}
+
+// SendTx tx_sendTx 发送已签名的交易，返回交易hash
+func (c *Client) SendTx(ctx context.Context, tx *Transaction) (string, error) {
+	var txHash string
+	err := c.Call(ctx, &txHash, "tx_sendTx", tx)
+	return txHash, err
+}
+
+// GetTxByHash tx_getTxByHash 根据交易hash查询交易，节点中没有此交易时返回nil
+func (c *Client) GetTxByHash(ctx context.Context, txHash string) (*TxInfo, error) {
+	info := new(TxInfo)
+	err := c.Call(ctx, info, "tx_getTxByHash", txHash)
+	if err == ErrNullResult || isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// GetBalance account_getBalance 查询账户余额，返回以LEMO为单位的字符串
+func (c *Client) GetBalance(ctx context.Context, lemoAddress string) (string, error) {
+	var balance string
+	err := c.Call(ctx, &balance, "account_getBalance", lemoAddress)
+	return balance, err
+}
+
+// GetAccount account_getAccount 查询账户的完整信息
+func (c *Client) GetAccount(ctx context.Context, lemoAddress string) (json.RawMessage, error) {
+	var account json.RawMessage
+	err := c.Call(ctx, &account, "account_getAccount", lemoAddress)
+	return account, err
+}
+
+// CurrentHeight chain_currentHeight 查询节点当前的区块高度
+func (c *Client) CurrentHeight(ctx context.Context) (uint32, error) {
+	var height uint32
+	err := c.Call(ctx, &height, "chain_currentHeight")
+	return height, err
+}
+
+// ChainID chain_chainID 查询节点的链id
+func (c *Client) ChainID(ctx context.Context) (uint16, error) {
+	var id uint16
+	err := c.Call(ctx, &id, "chain_chainID")
+	return id, err
+}
+
+// isNotFound 节点查询不到数据时返回的错误
+func isNotFound(err error) bool {
+	rpcErr, ok := err.(*RPCError)
+	if !ok {
+		return false
+	}
+	msg := strings.ToLower(rpcErr.Message)
+	return strings.Contains(msg, "not exist") || strings.Contains(msg, "not found")
+}
@@ -0,0 +1,112 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newRPCServer 启动一个测试节点，respond根据请求id返回响应体
+func newRPCServer(t *testing.T, respond func(id uint64) string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := new(jsonRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, respond(req.Id))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientCall(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(id uint64) string
+		check   func(result string, err error) error
+	}{
+		{
+			name: "result",
+			respond: func(id uint64) string {
+				return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"0x01"}`, id)
+			},
+			check: func(result string, err error) error {
+				if err != nil || result != "0x01" {
+					return fmt.Errorf("result %q, error %v", result, err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "rpc error",
+			respond: func(id uint64) string {
+				return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"error":{"code":-32000,"message":"nonce too low","data":"0x02"}}`, id)
+			},
+			check: func(result string, err error) error {
+				rpcErr, ok := err.(*RPCError)
+				if !ok || rpcErr.Code != -32000 || rpcErr.Message != "nonce too low" || string(rpcErr.Data) != `"0x02"` {
+					return fmt.Errorf("error %#v, want *RPCError -32000", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "id mismatch",
+			respond: func(id uint64) string {
+				return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"0x01"}`, id+1)
+			},
+			check: func(result string, err error) error {
+				if err != errIdMismatch {
+					return fmt.Errorf("error %v, want %v", err, errIdMismatch)
+				}
+				return nil
+			},
+		},
+		{
+			name: "null result",
+			respond: func(id uint64) string {
+				return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":null}`, id)
+			},
+			check: func(result string, err error) error {
+				if err != ErrNullResult {
+					return fmt.Errorf("error %v, want %v", err, ErrNullResult)
+				}
+				return nil
+			},
+		},
+		{
+			name: "invalid response",
+			respond: func(id uint64) string {
+				return "<html>502 Bad Gateway</html>"
+			},
+			check: func(result string, err error) error {
+				if err == nil {
+					return fmt.Errorf("invalid response returned result %q", result)
+				}
+				return nil
+			},
+		},
+	}
+	for _, test := range tests {
+		client := NewClient(newRPCServer(t, test.respond).URL, 0)
+		var result string
+		err := client.Call(context.Background(), &result, "chain_test", 1)
+		if checkErr := test.check(result, err); checkErr != nil {
+			t.Errorf("%s: %v", test.name, checkErr)
+		}
+	}
+}
+
+// result为nil时不关心结果，null也不算错误
+func TestClientCallIgnoreResult(t *testing.T) {
+	client := NewClient(newRPCServer(t, func(id uint64) string {
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":null}`, id)
+	}).URL, 0)
+	if err := client.Call(context.Background(), nil, "chain_test"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,181 @@
+// 水龙头网页: 获取工作量证明的题目、在浏览器中求解、提交申请，然后轮询申请状态直到到账
+(function () {
+  'use strict';
+
+  var POLL_INTERVAL = 3000;      // 查询申请状态的间隔
+  var POLL_TIMEOUT = 10 * 60000; // 最长查询多久
+  var RECENT_INTERVAL = 30000;   // 刷新最近到账的间隔
+  var BATCH = 2000;              // 求解时每批计算的hash个数，批之间让出主线程
+
+  var ERRORS = {
+    invalid_address: '地址不正确，请输入Lemo开头的40位地址',
+    address_cooldown: '该地址最近已经申请过',
+    ip_cooldown: '您最近已经申请过',
+    ip_quota: '您今天的申请次数已经用完',
+    rate_limited: '请求太频繁，请稍后再试',
+    budget_exhausted: '水龙头的测试币已经发放完毕',
+    challenge_failed: '工作量证明验证失败，请重新提交'
+  };
+
+  var form = document.getElementById('claim-form');
+  var input = document.getElementById('address');
+  var button = document.getElementById('submit');
+  var statusBox = document.getElementById('status');
+  var recentBody = document.querySelector('#recent tbody');
+
+  function showStatus(text, kind) {
+    statusBox.hidden = false;
+    statusBox.className = 'status' + (kind ? ' ' + kind : '');
+    statusBox.textContent = text;
+  }
+
+  // api 请求水龙头的接口，失败时抛出带有中文说明的错误
+  function api(method, path, body) {
+    var options = {method: method, headers: {}};
+    if (body) {
+      options.headers['Content-Type'] = 'application/json';
+      options.body = JSON.stringify(body);
+    }
+    return fetch(path, options).then(function (resp) {
+      return resp.json().catch(function () {
+        return {error: 'internal_error', message: resp.statusText};
+      }).then(function (data) {
+        if (!resp.ok) {
+          var message = ERRORS[data.error] || data.message || resp.statusText;
+          if (data.retryAfter) {
+            message += '，请在' + formatWait(data.retryAfter) + '之后再试';
+          }
+          throw new Error(message);
+        }
+        return data;
+      });
+    });
+  }
+
+  function formatWait(seconds) {
+    var minutes = Math.ceil(seconds / 60);
+    if (minutes < 60) {
+      return minutes + '分钟';
+    }
+    return Math.floor(minutes / 60) + '小时' + (minutes % 60) + '分钟';
+  }
+
+  function leadingZeroBits(hash) {
+    var n = 0;
+    for (var i = 0; i < hash.length; i++) {
+      if (hash[i] === 0) {
+        n += 8;
+        continue;
+      }
+      for (var bit = 7; bit >= 0 && !(hash[i] & (1 << bit)); bit--) {
+        n++;
+      }
+      break;
+    }
+    return n;
+  }
+
+  function utf8(text) {
+    return new TextEncoder().encode(text);
+  }
+
+  // solve 找到一个solution使 keccak256(nonce:solution) 的前difficulty个bit为0
+  function solve(challenge, onProgress) {
+    return new Promise(function (resolve) {
+      var counter = 0;
+      function batch() {
+        for (var end = counter + BATCH; counter < end; counter++) {
+          var solution = counter.toString();
+          if (leadingZeroBits(keccak256(utf8(challenge.nonce + ':' + solution))) >= challenge.difficulty) {
+            resolve(solution);
+            return;
+          }
+        }
+        onProgress(counter);
+        setTimeout(batch, 0);
+      }
+      batch();
+    });
+  }
+
+  // poll 查询申请状态，到账、失败或者超时后停止
+  function poll(id, started) {
+    api('GET', 'api/claim/' + id).then(function (claim) {
+      if (claim.status === 'confirmed') {
+        showStatus('测试币已到账，交易哈希: ' + claim.txHash, 'success');
+        loadRecent();
+        return;
+      }
+      if (claim.status === 'failed' || claim.status === 'expired') {
+        showStatus('发放失败，请稍后重新申请' + (claim.error ? ': ' + claim.error : ''), 'error');
+        return;
+      }
+      if (Date.now() - started > POLL_TIMEOUT) {
+        showStatus('交易还没有确认，申请编号 ' + id + '，请稍后刷新页面查看');
+        return;
+      }
+      showStatus('申请已受理(编号 ' + id + ')，' + (claim.txHash ? '等待交易上链: ' + claim.txHash : '正在发送交易') + '...');
+      setTimeout(function () { poll(id, started); }, POLL_INTERVAL);
+    }).catch(function (err) {
+      showStatus('查询申请状态失败: ' + err.message, 'error');
+    });
+  }
+
+  form.addEventListener('submit', function (event) {
+    event.preventDefault();
+    var address = input.value.trim();
+    if (!/^lemo[0-9a-z]{36}$/i.test(address)) {
+      showStatus(ERRORS.invalid_address, 'error');
+      return;
+    }
+    button.disabled = true;
+    showStatus('正在获取题目...');
+    api('GET', 'api/challenge').then(function (challenge) {
+      showStatus('正在计算工作量证明...');
+      return solve(challenge, function (tried) {
+        showStatus('正在计算工作量证明，已尝试 ' + tried + ' 次...');
+      }).then(function (solution) {
+        showStatus('正在提交申请...');
+        return api('POST', 'api/claim', {address: address, nonce: challenge.nonce, solution: solution});
+      });
+    }).then(function (claim) {
+      poll(claim.id, Date.now());
+    }).catch(function (err) {
+      showStatus(err.message, 'error');
+    }).then(function () {
+      button.disabled = false;
+    });
+  });
+
+  function cell(text, mono) {
+    var td = document.createElement('td');
+    td.textContent = text;
+    if (mono) {
+      td.className = 'mono';
+    }
+    return td;
+  }
+
+  function shorten(text) {
+    return text.length > 20 ? text.slice(0, 10) + '...' + text.slice(-8) : text;
+  }
+
+  function loadRecent() {
+    api('GET', 'api/recent').then(function (payouts) {
+      recentBody.textContent = '';
+      payouts.forEach(function (payout) {
+        var tr = document.createElement('tr');
+        tr.appendChild(cell(new Date(payout.time).toLocaleString()));
+        tr.appendChild(cell(shorten(payout.address), true));
+        tr.appendChild(cell(payout.amount + ' LEMO'));
+        tr.appendChild(cell(shorten(payout.txHash), true));
+        recentBody.appendChild(tr);
+      });
+    }).catch(function (err) {
+      console.log('load recent payouts error:', err);
+    });
+  }
+
+  loadRecent();
+  setInterval(loadRecent, RECENT_INTERVAL);
+})();
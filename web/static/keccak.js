@@ -0,0 +1,106 @@
+// keccak256，与服务端 common/crypto.Keccak256 相同(原始keccak填充，不是SHA3-256)
+// 64位的lane用两个32位整数表示: s[2i]为低32位，s[2i+1]为高32位
+(function (global) {
+  'use strict';
+
+  var RC = [
+    1, 0, 32898, 0, 32906, 2147483648, 2147516416, 2147483648,
+    32907, 0, 2147483649, 0, 2147516545, 2147483648, 32777, 2147483648,
+    138, 0, 136, 0, 2147516425, 0, 2147483658, 0,
+    2147516555, 0, 139, 2147483648, 32905, 2147483648, 32771, 2147483648,
+    32770, 2147483648, 128, 2147483648, 32778, 0, 2147483658, 2147483648,
+    2147516545, 2147483648, 32896, 2147483648, 2147483649, 0, 2147516424, 2147483648
+  ];
+  // 每个lane(下标为x+5y)循环左移的位数
+  var ROT = [
+    0, 1, 62, 28, 27,
+    36, 44, 6, 55, 20,
+    3, 10, 43, 25, 39,
+    41, 45, 15, 21, 8,
+    18, 2, 61, 56, 14
+  ];
+  var RATE = 136;
+
+  function keccakF(s) {
+    var C = new Uint32Array(10);
+    var B = new Uint32Array(50);
+    var x, y, i, j, n, lo, hi, t;
+    for (var round = 0; round < 24; round++) {
+      // theta
+      for (x = 0; x < 5; x++) {
+        C[2 * x] = s[2 * x] ^ s[2 * x + 10] ^ s[2 * x + 20] ^ s[2 * x + 30] ^ s[2 * x + 40];
+        C[2 * x + 1] = s[2 * x + 1] ^ s[2 * x + 11] ^ s[2 * x + 21] ^ s[2 * x + 31] ^ s[2 * x + 41];
+      }
+      for (x = 0; x < 5; x++) {
+        lo = C[2 * ((x + 1) % 5)];
+        hi = C[2 * ((x + 1) % 5) + 1];
+        var dlo = C[2 * ((x + 4) % 5)] ^ ((lo << 1) | (hi >>> 31));
+        var dhi = C[2 * ((x + 4) % 5) + 1] ^ ((hi << 1) | (lo >>> 31));
+        for (y = 0; y < 25; y += 5) {
+          s[2 * (y + x)] ^= dlo;
+          s[2 * (y + x) + 1] ^= dhi;
+        }
+      }
+      // rho和pi: B[y, 2x+3y] = rot(A[x, y])
+      for (i = 0; i < 25; i++) {
+        x = i % 5;
+        y = (i / 5) | 0;
+        j = y + 5 * ((2 * x + 3 * y) % 5);
+        lo = s[2 * i];
+        hi = s[2 * i + 1];
+        n = ROT[i];
+        if (n >= 32) {
+          t = lo; lo = hi; hi = t;
+          n -= 32;
+        }
+        if (n > 0) {
+          t = (lo << n) | (hi >>> (32 - n));
+          hi = (hi << n) | (lo >>> (32 - n));
+          lo = t;
+        }
+        B[2 * j] = lo;
+        B[2 * j + 1] = hi;
+      }
+      // chi
+      for (y = 0; y < 25; y += 5) {
+        for (x = 0; x < 5; x++) {
+          i = y + x;
+          var i1 = y + (x + 1) % 5;
+          var i2 = y + (x + 2) % 5;
+          s[2 * i] = B[2 * i] ^ (~B[2 * i1] & B[2 * i2]);
+          s[2 * i + 1] = B[2 * i + 1] ^ (~B[2 * i1 + 1] & B[2 * i2 + 1]);
+        }
+      }
+      // iota
+      s[0] ^= RC[2 * round];
+      s[1] ^= RC[2 * round + 1];
+    }
+  }
+
+  // keccak256 计算字节数组的hash，返回32字节的Uint8Array
+  function keccak256(bytes) {
+    var s = new Uint32Array(50);
+    var padded = new Uint8Array((Math.floor(bytes.length / RATE) + 1) * RATE);
+    padded.set(bytes);
+    padded[bytes.length] ^= 0x01;
+    padded[padded.length - 1] ^= 0x80;
+    for (var offset = 0; offset < padded.length; offset += RATE) {
+      for (var k = 0; k < RATE; k++) {
+        var lane = k >> 3;
+        var shift = 8 * (k & 3);
+        s[2 * lane + ((k & 7) >> 2)] ^= padded[offset + k] << shift;
+      }
+      keccakF(s);
+    }
+    var out = new Uint8Array(32);
+    for (var b = 0; b < 32; b++) {
+      out[b] = (s[2 * (b >> 3) + ((b & 7) >> 2)] >>> (8 * (b & 3))) & 0xff;
+    }
+    return out;
+  }
+
+  global.keccak256 = keccak256;
+  if (typeof module !== 'undefined') {
+    module.exports = keccak256;
+  }
+})(this);
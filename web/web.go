@@ -0,0 +1,22 @@
+// 水龙头的网页，静态文件编译进二进制，由faucet在 /faucet/ 路径下提供
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// 网页的静态文件: 输入地址、完成工作量证明、查询申请状态和最近到账的申请
+//
+//go:embed static
+var static embed.FS
+
+// Handler 返回提供静态文件的handler，prefix为网页的路径前缀，例如 /faucet/
+func Handler(prefix string) http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // static目录编译时已经确定存在
+	}
+	return http.StripPrefix(prefix, http.FileServer(http.FS(files)))
+}